@@ -0,0 +1,206 @@
+// Package capture records everything gohai reads from a system into a
+// bundle that gohai can later be pointed at with --root, so that
+// parsing problems can be reproduced without the system itself.
+//
+// A bundle is a gzipped tarball of the files that were read, at the
+// paths they were read from, along with the artifacts that were
+// recorded in plugins.ArtifactDir.
+package capture
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rackn/gohai/plugins"
+)
+
+// Writer is a plugins.Recorder that writes everything it is told
+// about into a bundle.
+type Writer struct {
+	mux     sync.Mutex
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	now     time.Time
+	seen    map[string]bool
+	devices map[string]os.FileMode
+	err     error
+}
+
+// NewWriter returns a Writer that writes a bundle to w.  Close must
+// be called to finish the bundle.
+func NewWriter(w io.Writer) *Writer {
+	gz := gzip.NewWriter(w)
+	return &Writer{
+		gz:      gz,
+		tw:      tar.NewWriter(gz),
+		now:     time.Now(),
+		seen:    map[string]bool{},
+		devices: map[string]os.FileMode{},
+	}
+}
+
+func (w *Writer) write(hdr *tar.Header, content []byte) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	hdr.Name = strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+	if w.err != nil || hdr.Name == "" || w.seen[hdr.Name] {
+		return
+	}
+	w.seen[hdr.Name] = true
+	hdr.ModTime = w.now
+	hdr.Size = int64(len(content))
+	if w.err = w.tw.WriteHeader(hdr); w.err == nil && len(content) > 0 {
+		_, w.err = w.tw.Write(content)
+	}
+}
+
+// File adds a file to the bundle.
+func (w *Writer) File(p string, content []byte) {
+	w.write(&tar.Header{Typeflag: tar.TypeReg, Name: p, Mode: 0644}, content)
+}
+
+// Dir adds a directory to the bundle.
+func (w *Writer) Dir(p string) {
+	w.write(&tar.Header{Typeflag: tar.TypeDir, Name: p, Mode: 0755}, nil)
+}
+
+// Link adds a symlink to the bundle.
+func (w *Writer) Link(p, target string) {
+	w.write(&tar.Header{Typeflag: tar.TypeSymlink, Name: p, Linkname: target, Mode: 0777}, nil)
+}
+
+// Device records a device node.  They cannot be created without
+// privileges, so they are kept in plugins.DevicesArtifact when the
+// Writer is closed.
+func (w *Writer) Device(p string, mode os.FileMode) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.devices[path.Clean("/"+p)] = mode
+}
+
+// Artifact adds an artifact to the bundle.
+func (w *Writer) Artifact(name string, content []byte) {
+	w.File(path.Join(plugins.ArtifactDir, name), content)
+}
+
+// Close finishes writing the bundle, and returns the first error
+// encountered while writing it.
+func (w *Writer) Close() error {
+	if len(w.devices) > 0 {
+		buf, err := json.Marshal(w.devices)
+		if err != nil {
+			return err
+		}
+		w.Artifact(plugins.DevicesArtifact, buf)
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// checkParents makes sure that nothing between dir and target is a
+// symlink, so that extracting a bundle cannot write outside of dir.
+func checkParents(dir, target string) error {
+	rel, err := filepath.Rel(dir, filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	cur := dir
+	for _, comp := range strings.Split(rel, string(filepath.Separator)) {
+		if comp == "." {
+			continue
+		}
+		cur = filepath.Join(cur, comp)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symlink", cur)
+		}
+	}
+	return nil
+}
+
+// Extract unpacks the bundle in r into dir.
+func Extract(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := checkParents(dir, target); err != nil {
+			return fmt.Errorf("Refusing to extract %s: %v", hdr.Name, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, target)
+		case tar.TypeReg:
+			var buf []byte
+			if buf, err = ioutil.ReadAll(tr); err == nil {
+				err = ioutil.WriteFile(target, buf, 0644)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Unpack extracts the bundle file at p into a new temporary
+// directory, and returns the directory.  It is up to the caller to
+// remove it.
+func Unpack(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	dir, err := ioutil.TempDir("", "gohai-replay-")
+	if err != nil {
+		return "", err
+	}
+	if err := Extract(f, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
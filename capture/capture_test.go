@@ -0,0 +1,76 @@
+package capture
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rackn/gohai/plugins"
+)
+
+func TestRoundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.File("/proc/cpuinfo", []byte("processor\t: 0\n"))
+	w.File("proc/cpuinfo", []byte("recorded twice"))
+	w.Dir("/sys/class/net")
+	w.Link("/sys/class/net/lo", "../../devices/virtual/net/lo")
+	w.File("/sys/devices/virtual/net/lo/mtu", []byte("65536\n"))
+	w.Device("/dev/sda1", os.ModeDevice|0660)
+	w.Artifact("commands/lshw_-json", []byte("{}"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "gohai-capture-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := Extract(buf, dir); err != nil {
+		t.Fatal(err)
+	}
+	env := &plugins.Env{Root: dir}
+	for p, want := range map[string]string{
+		"/proc/cpuinfo":         "processor\t: 0\n",
+		"/sys/class/net/lo/mtu": "65536\n",
+	} {
+		got, err := env.ReadFile(p)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v want %q", p, got, err, want)
+		}
+	}
+	fi, err := env.Stat("/dev/sda1")
+	if err != nil || fi.Mode()&os.ModeDevice == 0 {
+		t.Errorf("/dev/sda1: got %v, %v", fi, err)
+	}
+	if out, err := env.Run("lshw", "-json"); err != nil || string(out) != "{}" {
+		t.Errorf("lshw: got %q, %v", out, err)
+	}
+}
+
+func TestExtractRefusesEscapes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: "etc", Linkname: "/etc", Mode: 0777})
+	content := []byte("pwned\n")
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "etc/gohai-test", Mode: 0644, Size: int64(len(content))})
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+	dir, err := ioutil.TempDir("", "gohai-capture-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := Extract(buf, dir); err == nil {
+		t.Errorf("Extracting through a symlink succeeded")
+	}
+	if _, err := os.Lstat(filepath.Join("/etc", "gohai-test")); err == nil {
+		t.Errorf("Extract wrote outside of %s", dir)
+	}
+}
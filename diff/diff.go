@@ -0,0 +1,353 @@
+// Package diff compares two documents gohai has written, and reports
+// the components that were added, removed or changed between them.
+//
+// Arrays of components are not compared item by item.  Their items
+// are matched up by what identifies them (disks by serial number,
+// network interfaces by MAC address, DIMMs by locator and so on), so
+// that a component that moved or was replaced is reported as such
+// instead of as a change to everything after it.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rackn/gohai/format"
+	"github.com/rackn/gohai/schema"
+)
+
+// Kinds of Change.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is one difference between two documents.  Path is written
+// the way gohai --query takes it, with components in arrays picked
+// out by what they were matched on, like
+// Storage.Disks[?Serial=="ZC1234AB"].Size.
+type Change struct {
+	Kind string
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return "+ " + c.Path
+	case Removed:
+		return "- " + c.Path
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, compact(c.Old), compact(c.New))
+}
+
+func compact(v interface{}) string {
+	buf, _ := json.Marshal(v)
+	return string(buf)
+}
+
+// Keys says how the items of the arrays at a path are matched up.
+// Two items are matched on the first of the keys that they have the
+// same value for, and that no other item on either side has.  A key
+// can be several fields separated by commas.  Items that are not
+// matched on any key are reported as added or removed.  Arrays of
+// objects not listed here are compared by position.
+var Keys = map[string][]string{
+	"DMI.Baseboards":        {"SerialNumber", "ProductName"},
+	"DMI.Chassis":           {"SerialNumber", "AssetTag"},
+	"DMI.Memory.Devices":    {"DeviceLocator", "BankLocator,DeviceLocator"},
+	"DMI.Processors.Items":  {"SocketDesignation"},
+	"Networking.Interfaces": {"HardwareAddr", "StableName", "Name"},
+	// Link modes are sets, so they are matched on everything in them.
+	"Networking.Interfaces[*].Advertised":     {"Name,Phy,Duplex,Feature"},
+	"Networking.Interfaces[*].PeerAdvertised": {"Name,Phy,Duplex,Feature"},
+	"Networking.Interfaces[*].Supported":      {"Name,Phy,Duplex,Feature"},
+	"Storage.Controllers":                     {"businfo", "serial", "id"},
+	"Storage.Disks":                           {"Serial", "Name"},
+	"Storage.Volumes":                         {"Name"},
+}
+
+// Volatile lists the values that change from one run to the next on
+// a machine nothing was done to.  They are left out unless asked for.
+// Items in arrays are written as [*].
+var Volatile = []string{
+	"Errors",
+	"Warnings",
+	"Storage.Volumes[*].Blocks.Avail",
+	"Storage.Volumes[*].Blocks.Free",
+	"System.Memory.Available",
+	"System.Memory.Free",
+	"System.NUMA[*].Memory.Free",
+	"System.Processors[*].Speed",
+}
+
+// Options controls what Compare reports.
+type Options struct {
+	// Volatile includes changes to the values in Volatile.
+	Volatile bool
+}
+
+// Load reads a document gohai has written in JSON, and converts it to
+// the current schema version, so that documents written in different
+// versions can be compared.
+func Load(file string) (interface{}, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	if err := json.Unmarshal(buf, &res); err != nil {
+		return nil, fmt.Errorf("%s is not JSON: %v", file, err)
+	}
+	doc, ok := res.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not a gohai document", file)
+	}
+	if err := schema.Convert(doc, schema.Version); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return format.Tree(doc)
+}
+
+// Compare returns the changes from old to new.  Both are turned into
+// their JSON form first.
+func Compare(old, new interface{}, opts Options) ([]Change, error) {
+	o, err := format.Tree(old)
+	if err != nil {
+		return nil, err
+	}
+	n, err := format.Tree(new)
+	if err != nil {
+		return nil, err
+	}
+	d := &differ{opts: opts}
+	d.value("", "", o, n)
+	return d.changes, nil
+}
+
+type differ struct {
+	opts    Options
+	changes []Change
+}
+
+func (d *differ) ignored(general string) bool {
+	if d.opts.Volatile {
+		return false
+	}
+	for _, v := range Volatile {
+		if general == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *differ) add(kind, path string, old, new interface{}) {
+	d.changes = append(d.changes, Change{Kind: kind, Path: path, Old: old, New: new})
+}
+
+// value compares o and n found at path.  general is path with every
+// array item written as [*], which is what Keys and Volatile use.
+func (d *differ) value(path, general string, o, n interface{}) {
+	if d.ignored(general) {
+		return
+	}
+	switch ov := o.(type) {
+	case map[string]interface{}:
+		if nv, ok := n.(map[string]interface{}); ok {
+			d.object(path, general, ov, nv)
+			return
+		}
+	case []interface{}:
+		if nv, ok := n.([]interface{}); ok && (objects(ov) || objects(nv)) {
+			d.array(path, general, ov, nv)
+			return
+		}
+	}
+	if !reflect.DeepEqual(o, n) {
+		d.add(Changed, path, o, n)
+	}
+}
+
+func (d *differ) object(path, general string, o, n map[string]interface{}) {
+	keys := []string{}
+	for k := range o {
+		keys = append(keys, k)
+	}
+	for k := range n {
+		if _, ok := o[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sub, subGeneral := format.Key(path, k), format.Key(general, k)
+		if d.ignored(subGeneral) {
+			continue
+		}
+		ov, inOld := o[k]
+		nv, inNew := n[k]
+		switch {
+		case !inNew:
+			d.add(Removed, sub, ov, nil)
+		case !inOld:
+			d.add(Added, sub, nil, nv)
+		default:
+			d.value(sub, subGeneral, ov, nv)
+		}
+	}
+}
+
+// objects returns whether any of the items in arr are objects.
+func objects(arr []interface{}) bool {
+	for _, item := range arr {
+		if _, ok := item.(map[string]interface{}); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *differ) array(path, general string, o, n []interface{}) {
+	itemGeneral := general + "[*]"
+	keys, ok := Keys[general]
+	if !ok {
+		for i := 0; i < len(o) || i < len(n); i++ {
+			sub := format.Index(path, i)
+			switch {
+			case i >= len(n):
+				d.add(Removed, sub, o[i], nil)
+			case i >= len(o):
+				d.add(Added, sub, nil, n[i])
+			default:
+				d.value(sub, itemGeneral, o[i], n[i])
+			}
+		}
+		return
+	}
+	newFor := make([]int, len(o))
+	for i := range newFor {
+		newFor[i] = -1
+	}
+	matched := make([]bool, len(n))
+	for _, key := range keys {
+		fields := strings.Split(key, ",")
+		oldVals := keyValues(o, fields)
+		newVals := keyValues(n, fields)
+		for i, val := range oldVals {
+			if val == "" || newFor[i] >= 0 || count(oldVals, val) != 1 || count(newVals, val) != 1 {
+				continue
+			}
+			for j := range newVals {
+				if newVals[j] == val && !matched[j] {
+					newFor[i], matched[j] = j, true
+				}
+			}
+		}
+	}
+	for i := range o {
+		sub := itemPath(path, keys, o, i)
+		if newFor[i] < 0 {
+			d.add(Removed, sub, o[i], nil)
+			continue
+		}
+		d.value(sub, itemGeneral, o[i], n[newFor[i]])
+	}
+	for j := range n {
+		if !matched[j] {
+			d.add(Added, itemPath(path, keys, n, j), nil, n[j])
+		}
+	}
+}
+
+// itemPath returns the path to items[i] in the array at path, picked
+// out by the first key that it has a value no other item has for.
+func itemPath(path string, keys []string, items []interface{}, i int) string {
+	for _, key := range keys {
+		fields := strings.Split(key, ",")
+		vals := keyValues(items, fields)
+		if vals[i] != "" && count(vals, vals[i]) == 1 {
+			return selector(path, fields, items[i])
+		}
+	}
+	return format.Index(path, i)
+}
+
+// unset are the values that do not identify anything.
+var unset = map[string]bool{
+	"":                       true,
+	"0":                      true,
+	"00:00:00:00:00:00":      true,
+	"none":                   true,
+	"not specified":          true,
+	"unknown":                true,
+	"to be filled by o.e.m.": true,
+}
+
+// keyValues returns the value of the key made of fields for each
+// item, or "" if an item does not have one.  Items have a key made of
+// several fields if any of the fields is set.
+func keyValues(items []interface{}, fields []string) []string {
+	res := make([]string, len(items))
+	for i, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		parts := make([]string, len(fields))
+		set := false
+		for f, field := range fields {
+			switch obj[field].(type) {
+			case nil, string, int64, float64, bool:
+			default:
+				parts = nil
+			}
+			if parts == nil {
+				break
+			}
+			parts[f] = format.Scalar(obj[field])
+			set = set || !unset[strings.ToLower(strings.TrimSpace(parts[f]))]
+		}
+		if parts != nil && set {
+			res[i] = strings.Join(parts, "\x00")
+		}
+	}
+	return res
+}
+
+func count(vals []string, val string) int {
+	res := 0
+	for _, v := range vals {
+		if v == val {
+			res++
+		}
+	}
+	return res
+}
+
+// selector returns the path to item in the array at path, picked out
+// by fields.
+func selector(path string, fields []string, item interface{}) string {
+	obj := item.(map[string]interface{})
+	conds := make([]string, len(fields))
+	for i, field := range fields {
+		val := obj[field]
+		switch v := val.(type) {
+		case nil:
+			conds[i] = field + "==null"
+		case string:
+			conds[i] = field + "==" + strconv.Quote(v)
+		default:
+			conds[i] = field + "==" + format.Scalar(v)
+		}
+	}
+	return path + "[?" + strings.Join(conds, " && ") + "]"
+}
@@ -0,0 +1,177 @@
+package diff
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const before = `{
+  "DMI": {"Memory": {"Devices": [
+    {"DeviceLocator": "A1", "BankLocator": "P0", "SerialNumber": "1111", "Size": 16384},
+    {"DeviceLocator": "A2", "BankLocator": "P0", "SerialNumber": "2222", "Size": 16384},
+    {"DeviceLocator": "DIMM 0", "BankLocator": "P1", "SerialNumber": "3333", "Size": 16384},
+    {"DeviceLocator": "DIMM 0", "BankLocator": "P2", "SerialNumber": "4444", "Size": 16384}
+  ]}},
+  "Networking": {"Interfaces": [
+    {"Name": "lo", "HardwareAddr": "", "StableName": ""},
+    {"Name": "bond0", "HardwareAddr": "24:6e:96:3c:5a:10", "StableName": ""},
+    {"Name": "eno1", "HardwareAddr": "24:6e:96:3c:5a:10", "StableName": "eno1", "Sys": {"BusAddress": "0000:01:00.0"}},
+    {"Name": "eno2", "HardwareAddr": "24:6e:96:3c:5a:10", "StableName": "eno2", "Sys": {"BusAddress": "0000:01:00.1"}},
+    {"Name": "enp4s0", "HardwareAddr": "0c:42:a1:5e:7d:30", "StableName": "enp4s0", "Sys": {"BusAddress": "0000:04:00.0"}}
+  ]},
+  "Storage": {
+    "Disks": [
+      {"Name": "/dev/sda", "Serial": "ZC1234AB", "Size": 1000},
+      {"Name": "/dev/sdb", "Serial": "ZC1234CD", "Size": 1000},
+      {"Name": "/dev/nvme0n1", "Serial": "UNKNOWN", "Size": 2000}
+    ],
+    "Volumes": [{"Name": "/", "Blocks": {"Total": 100, "Free": 50, "Avail": 40}}]
+  },
+  "System": {"Memory": {"Total": 65536, "Free": 1000}, "Processors": [{"ID": 0, "Speed": "1200.000"}]},
+  "Errors": [{"Class": "DMI", "Step": "smbios", "Error": "no tables"}]
+}`
+
+const after = `{
+  "DMI": {"Memory": {"Devices": [
+    {"DeviceLocator": "A1", "BankLocator": "P0", "SerialNumber": "1111", "Size": 16384},
+    {"DeviceLocator": "A2", "BankLocator": "P0", "SerialNumber": "9999", "Size": 16384},
+    {"DeviceLocator": "DIMM 0", "BankLocator": "P1", "SerialNumber": "3333", "Size": 16384},
+    {"DeviceLocator": "DIMM 0", "BankLocator": "P2", "SerialNumber": "4444", "Size": 32768}
+  ]}},
+  "Networking": {"Interfaces": [
+    {"Name": "lo", "HardwareAddr": "", "StableName": ""},
+    {"Name": "bond0", "HardwareAddr": "24:6e:96:3c:5a:10", "StableName": ""},
+    {"Name": "enp5s0", "HardwareAddr": "0c:42:a1:5e:7d:30", "StableName": "enp5s0", "Sys": {"BusAddress": "0000:05:00.0"}},
+    {"Name": "eno1", "HardwareAddr": "24:6e:96:3c:5a:10", "StableName": "eno1", "Sys": {"BusAddress": "0000:01:00.0"}},
+    {"Name": "eno2", "HardwareAddr": "24:6e:96:3c:5a:10", "StableName": "eno2", "Sys": {"BusAddress": "0000:01:00.1"}}
+  ]},
+  "Storage": {
+    "Disks": [
+      {"Name": "/dev/nvme0n1", "Serial": "UNKNOWN", "Size": 2000},
+      {"Name": "/dev/sda", "Serial": "ZC1234AB", "Size": 1000},
+      {"Name": "/dev/sdb", "Serial": "ZC9999ZZ", "Size": 1000},
+      {"Name": "/dev/sdc", "Serial": "ZC5555EE", "Size": 4000}
+    ],
+    "Volumes": [{"Name": "/", "Blocks": {"Total": 100, "Free": 20, "Avail": 10}}]
+  },
+  "System": {"Memory": {"Total": 65536, "Free": 2000}, "Processors": [{"ID": 0, "Speed": "2400.000"}]}
+}`
+
+func load(t *testing.T, doc string) interface{} {
+	t.Helper()
+	var res interface{}
+	if err := json.Unmarshal([]byte(doc), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func lines(changes []Change) string {
+	res := make([]string, len(changes))
+	for i := range changes {
+		res[i] = changes[i].String()
+	}
+	return strings.Join(res, "\n")
+}
+
+func TestCompare(t *testing.T) {
+	changes, err := Compare(load(t, before), load(t, after), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		`~ DMI.Memory.Devices[?DeviceLocator=="A2"].SerialNumber: "2222" -> "9999"`,
+		`~ DMI.Memory.Devices[?BankLocator=="P2" && DeviceLocator=="DIMM 0"].Size: 16384 -> 32768`,
+		`~ Networking.Interfaces[?HardwareAddr=="0c:42:a1:5e:7d:30"].Name: "enp4s0" -> "enp5s0"`,
+		`~ Networking.Interfaces[?HardwareAddr=="0c:42:a1:5e:7d:30"].StableName: "enp4s0" -> "enp5s0"`,
+		`~ Networking.Interfaces[?HardwareAddr=="0c:42:a1:5e:7d:30"].Sys.BusAddress: "0000:04:00.0" -> "0000:05:00.0"`,
+		`~ Storage.Disks[?Serial=="ZC1234CD"].Serial: "ZC1234CD" -> "ZC9999ZZ"`,
+		`+ Storage.Disks[?Serial=="ZC5555EE"]`,
+	}, "\n")
+	if got := lines(changes); got != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", got, want)
+	}
+	for _, c := range changes {
+		if c.Kind == Added && c.New.(map[string]interface{})["Name"] != "/dev/sdc" {
+			t.Errorf("Added disk is %v", c.New)
+		}
+	}
+}
+
+func TestCompareVolatile(t *testing.T) {
+	changes, err := Compare(load(t, before), load(t, after), Options{Volatile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := lines(changes)
+	for _, want := range []string{
+		`- Errors`,
+		`~ Storage.Volumes[?Name=="/"].Blocks.Free: 50 -> 20`,
+		`~ System.Memory.Free: 1000 -> 2000`,
+		`~ System.Processors[0].Speed: "1200.000" -> "2400.000"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Missing %s from:\n%s", want, got)
+		}
+	}
+}
+
+func TestCompareSame(t *testing.T) {
+	changes, err := Compare(load(t, before), load(t, before), Options{Volatile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes, got:\n%s", lines(changes))
+	}
+}
+
+func TestRemoved(t *testing.T) {
+	old := `{"Storage": {"Disks": [{"Name": "/dev/sda", "Serial": "A"}, {"Name": "/dev/sdb", "Serial": "B"}]},
+	         "Networking": {"Addrs": {"10.0.0.1/24": "eth0"}}}`
+	new := `{"Storage": {"Disks": [{"Name": "/dev/sda", "Serial": "A"}]}}`
+	changes, err := Compare(load(t, old), load(t, new), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		`- Networking`,
+		`- Storage.Disks[?Serial=="B"]`,
+	}, "\n")
+	if got := lines(changes); got != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", got, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohai-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"good.json":  before,
+		"bad.json":   `{"DMI":`,
+		"array.json": `[]`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc, err := Load(filepath.Join(dir, "good.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total := doc.(map[string]interface{})["System"].(map[string]interface{})["Memory"].(map[string]interface{})["Total"]; total != int64(65536) {
+		t.Errorf("Total memory is %#v", total)
+	}
+	for _, name := range []string{"bad.json", "array.json", "missing.json"} {
+		if _, err := Load(filepath.Join(dir, name)); err == nil {
+			t.Errorf("Expected %s to fail to load", name)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package facts
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// oses are the names uname gives the operating systems Go knows.
+var oses = map[string]string{
+	"linux":   "Linux",
+	"darwin":  "Darwin",
+	"freebsd": "FreeBSD",
+	"netbsd":  "NetBSD",
+	"openbsd": "OpenBSD",
+	"windows": "Windows",
+}
+
+func system(doc map[string]interface{}) string {
+	os := str(doc, "System.OS")
+	if name, ok := oses[os]; ok {
+		return name
+	}
+	return os
+}
+
+// ansibleVirt are the virtualization types Ansible has for the
+// hypervisors the DMI class detects.
+var ansibleVirt = map[string]string{
+	"KVM":        "kvm",
+	"QEMU":       "kvm",
+	"VMware":     "VMware",
+	"VirtualBox": "virtualbox",
+	"Xen":        "xen",
+	"Bochs":      "kvm",
+	"Parallels":  "parallels",
+	"BHYVE":      "bhyve",
+	"LPAR":       "powervm",
+}
+
+var ansibleUnits = []string{"bytes", "KB", "MB", "GB", "TB", "PB"}
+
+// na is a fact Ansible has "NA" for when it cannot be found.
+func na(s string) string {
+	if s == "" {
+		return "NA"
+	}
+	return s
+}
+
+// ansibleName is the name of the fact for an interface.
+func ansibleName(intf string) string {
+	return "ansible_" + strings.NewReplacer("-", "_", ".", "_", ":", "_").Replace(intf)
+}
+
+func boolStr(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func ansibleInterface(intf interface{}) map[string]interface{} {
+	res := map[string]interface{}{
+		"device": str(intf, "Name"),
+		"mtu":    num(intf, "MTU"),
+		"active": hasFlag(intf, "up"),
+	}
+	switch {
+	case hasFlag(intf, "loopback"):
+		res["type"] = "loopback"
+	case flag(intf, "Sys.IsBridge"):
+		res["type"] = "bridge"
+		res["interfaces"] = append([]interface{}{}, list(intf, "Sys.Bridge.Members")...)
+	case flag(intf, "Sys.IsBond") && str(intf, "Sys.Bond.Master") == "":
+		// Members of a bond are marked as being in one too.
+		res["type"] = "bonding"
+		res["slaves"] = append([]interface{}{}, list(intf, "Sys.Bond.Members")...)
+		set(res, "mode", str(intf, "Sys.Bond.Mode"))
+	default:
+		res["type"] = "ether"
+	}
+	set(res, "macaddress", str(intf, "HardwareAddr"))
+	set(res, "module", str(intf, "Driver"))
+	if speed := num(intf, "Speed"); speed > 0 && speed != 1<<32-1 {
+		res["speed"] = speed
+	}
+	if flag(intf, "Sys.IsPhysical") {
+		bus := strings.Split(str(intf, "Sys.BusAddress"), "/")
+		set(res, "pciid", bus[len(bus)-1])
+	}
+	v4 := []interface{}{}
+	v6 := []interface{}{}
+	for _, b := range bindings(intf) {
+		if b.v4() {
+			broadcast := make(net.IP, len(b.network.IP.To4()))
+			for i, octet := range b.network.IP.To4() {
+				broadcast[i] = octet | ^b.network.Mask[i]
+			}
+			v4 = append(v4, map[string]interface{}{
+				"address":   b.ip.String(),
+				"netmask":   b.netmask(),
+				"network":   b.network.IP.String(),
+				"broadcast": broadcast.String(),
+				"prefix":    fmt.Sprint(b.prefix()),
+			})
+		} else {
+			v6 = append(v6, map[string]interface{}{
+				"address": b.ip.String(),
+				"prefix":  fmt.Sprint(b.prefix()),
+				"scope":   b.scope(),
+			})
+		}
+	}
+	if len(v4) > 0 {
+		res["ipv4"] = v4[0]
+		set(res, "ipv4_secondaries", v4[1:])
+	}
+	set(res, "ipv6", v6)
+	return res
+}
+
+// Ansible returns the facts the Ansible setup module gathers that can
+// be had from doc, a gohai document.  They are returned the way a
+// module returns facts, so that gohai can also be used as one.
+func Ansible(doc map[string]interface{}) map[string]interface{} {
+	f := map[string]interface{}{}
+	if _, ok := doc["System"]; ok {
+		m := machine(doc)
+		f["ansible_architecture"] = m
+		f["ansible_machine"] = m
+		f["ansible_userspace_architecture"] = m
+		f["ansible_system"] = system(doc)
+		f["ansible_kernel"] = str(doc, "System.Kernel")
+		mib := int64(1 << 20)
+		total := num(doc, "System.Memory.Total")
+		free := num(doc, "System.Memory.Free")
+		avail := num(doc, "System.Memory.Available")
+		f["ansible_memtotal_mb"] = total / mib
+		f["ansible_memfree_mb"] = free / mib
+		f["ansible_memory_mb"] = map[string]interface{}{
+			"real":    map[string]interface{}{"total": total / mib, "free": free / mib, "used": (total - free) / mib},
+			"nocache": map[string]interface{}{"free": avail / mib, "used": (total - avail) / mib},
+		}
+		t := processors(doc)
+		procs := []interface{}{}
+		for i := range t.models {
+			procs = append(procs, fmt.Sprint(i), t.vendors[i], t.models[i])
+		}
+		f["ansible_processor"] = procs
+		f["ansible_processor_count"] = t.sockets
+		f["ansible_processor_cores"] = t.coresPerSocket
+		f["ansible_processor_threads_per_core"] = t.threadsPerCore
+		f["ansible_processor_vcpus"] = t.threads
+		f["ansible_processor_nproc"] = t.threads
+	}
+	if _, ok := doc["Distro"]; ok {
+		name, family, major, _ := distribution(doc)
+		f["ansible_distribution"] = name
+		f["ansible_os_family"] = family
+		f["ansible_distribution_version"] = na(str(doc, "Distro.Version"))
+		f["ansible_distribution_major_version"] = na(major)
+		f["ansible_distribution_release"] = na(str(doc, "Distro.Codename"))
+		f["ansible_distribution_file_path"] = str(doc, "Distro.Source")
+	}
+	if dmi, ok := doc["DMI"]; ok && dmi != nil {
+		for fact, path := range map[string]string{
+			"bios_vendor":       "BIOS.Vendor",
+			"bios_version":      "BIOS.BIOSVersion",
+			"bios_date":         "BIOS.ReleaseDate",
+			"system_vendor":     "System.Manufacturer",
+			"product_name":      "System.ProductName",
+			"product_serial":    "System.SerialNumber",
+			"product_uuid":      "System.UUID",
+			"product_version":   "System.Version",
+			"board_vendor":      "Baseboards.0.Manufacturer",
+			"board_name":        "Baseboards.0.ProductName",
+			"board_serial":      "Baseboards.0.SerialNumber",
+			"board_version":     "Baseboards.0.Version",
+			"board_asset_tag":   "Baseboards.0.AssetTag",
+			"chassis_vendor":    "Chassis.0.Manufacturer",
+			"chassis_serial":    "Chassis.0.SerialNumber",
+			"chassis_version":   "Chassis.0.Version",
+			"chassis_asset_tag": "Chassis.0.AssetTag",
+		} {
+			f["ansible_"+fact] = na(dmiStr(dmi, path))
+		}
+		if virt, ok := ansibleVirt[str(dmi, "Hypervisor")]; ok {
+			f["ansible_virtualization_type"] = virt
+			f["ansible_virtualization_role"] = "guest"
+		} else {
+			f["ansible_virtualization_type"] = "NA"
+			f["ansible_virtualization_role"] = "NA"
+		}
+	}
+	if _, ok := doc["Networking"]; ok {
+		names := []interface{}{}
+		all4 := []interface{}{}
+		all6 := []interface{}{}
+		for _, intf := range list(doc, "Networking.Interfaces") {
+			name := str(intf, "Name")
+			names = append(names, name)
+			f[ansibleName(name)] = ansibleInterface(intf)
+			for _, b := range bindings(intf) {
+				if b.ip.IsLoopback() {
+					continue
+				}
+				if b.v4() {
+					all4 = append(all4, b.ip.String())
+				} else {
+					all6 = append(all6, b.ip.String())
+				}
+			}
+		}
+		f["ansible_interfaces"] = names
+		f["ansible_all_ipv4_addresses"] = all4
+		f["ansible_all_ipv6_addresses"] = all6
+		// gohai does not read the routing table, so the interface
+		// the default route is most likely on stands in for it.
+		if intf := primary(doc); intf != nil {
+			def := map[string]interface{}{"interface": str(intf, "Name")}
+			facts := ansibleInterface(intf)
+			for k, v := range facts["ipv4"].(map[string]interface{}) {
+				def[k] = v
+			}
+			for _, k := range []string{"macaddress", "mtu", "type"} {
+				set(def, k, facts[k])
+			}
+			f["ansible_default_ipv4"] = def
+		}
+	}
+	if _, ok := doc["Storage"]; ok {
+		devices := map[string]interface{}{}
+		for _, d := range list(doc, "Storage.Disks") {
+			dev := map[string]interface{}{
+				"size":       human(num(d, "Size"), ansibleUnits),
+				"removable":  boolStr(flag(d, "Removable")),
+				"rotational": boolStr(flag(d, "Rotational")),
+				"partitions": map[string]interface{}{},
+			}
+			for k, path := range map[string]string{"vendor": "Vendor", "model": "Product", "serial": "Serial"} {
+				if v := dmiStr(d, path); v != "" {
+					dev[k] = v
+				} else {
+					dev[k] = nil
+				}
+			}
+			devices[disk(d)] = dev
+		}
+		f["ansible_devices"] = devices
+		mounts := []interface{}{}
+		for _, v := range mounted(doc) {
+			bsize := num(v, "Blocks.Size")
+			total, free, avail := num(v, "Blocks.Total"), num(v, "Blocks.Free"), num(v, "Blocks.Avail")
+			mounts = append(mounts, map[string]interface{}{
+				"mount":           str(v, "Name"),
+				"device":          str(v, "BackingDevice"),
+				"fstype":          str(v, "Filesystem"),
+				"options":         str(v, "Options"),
+				"size_total":      total * bsize,
+				"size_available":  avail * bsize,
+				"block_size":      bsize,
+				"block_total":     total,
+				"block_available": avail,
+				"block_used":      total - free,
+			})
+		}
+		f["ansible_mounts"] = mounts
+	}
+	return map[string]interface{}{"ansible_facts": f, "changed": false}
+}
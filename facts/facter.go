@@ -0,0 +1,207 @@
+package facts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// facterVirt are the virtual facts Facter has for the hypervisors the
+// DMI class detects.
+var facterVirt = map[string]string{
+	"KVM":        "kvm",
+	"QEMU":       "kvm",
+	"VMware":     "vmware",
+	"VirtualBox": "virtualbox",
+	"Xen":        "xenhvm",
+	"Bochs":      "bochs",
+	"Parallels":  "parallels",
+	"BHYVE":      "bhyve",
+	"LPAR":       "lpar",
+}
+
+var facterUnits = []string{"bytes", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// usage is how Facter writes how much of something, of size total
+// with the name given, is used.
+func usage(m map[string]interface{}, name string, size, available, used int64) {
+	m[name] = human(size, facterUnits)
+	m[name+"_bytes"] = size
+	m["available"] = human(available, facterUnits)
+	m["available_bytes"] = available
+	m["used"] = human(used, facterUnits)
+	m["used_bytes"] = used
+	if size > 0 {
+		m["capacity"] = fmt.Sprintf("%.2f%%", float64(used)*100/float64(size))
+	}
+}
+
+func facterInterface(intf interface{}) map[string]interface{} {
+	res := map[string]interface{}{"mtu": num(intf, "MTU")}
+	set(res, "mac", str(intf, "HardwareAddr"))
+	v4 := []interface{}{}
+	v6 := []interface{}{}
+	for _, b := range bindings(intf) {
+		binding := map[string]interface{}{
+			"address": b.ip.String(),
+			"netmask": b.netmask(),
+			"network": b.network.IP.String(),
+		}
+		if b.v4() {
+			if len(v4) == 0 {
+				res["ip"], res["netmask"], res["network"] = binding["address"], binding["netmask"], binding["network"]
+			}
+			v4 = append(v4, binding)
+		} else {
+			if len(v6) == 0 {
+				res["ip6"], res["netmask6"], res["network6"] = binding["address"], binding["netmask"], binding["network"]
+				res["scope6"] = b.scope()
+			}
+			v6 = append(v6, binding)
+		}
+	}
+	set(res, "bindings", v4)
+	set(res, "bindings6", v6)
+	return res
+}
+
+// Facter returns the core facts Facter gathers that can be had from
+// doc, a gohai document, in Facter's hierarchy.
+func Facter(doc map[string]interface{}) map[string]interface{} {
+	f := map[string]interface{}{}
+	if _, ok := doc["System"]; ok {
+		m := machine(doc)
+		kernel := str(doc, "System.Kernel")
+		version := strings.SplitN(kernel, "-", 2)[0]
+		major := strings.Split(version, ".")
+		if len(major) > 2 {
+			major = major[:2]
+		}
+		f["kernel"] = system(doc)
+		f["kernelrelease"] = kernel
+		f["kernelversion"] = version
+		f["kernelmajversion"] = strings.Join(major, ".")
+		f["architecture"] = m
+		f["hardwaremodel"] = m
+		f["os"] = map[string]interface{}{
+			"architecture": m,
+			"hardware":     m,
+		}
+		t := processors(doc)
+		procs := map[string]interface{}{
+			"count":         t.threads,
+			"physicalcount": t.sockets,
+			"cores":         t.coresPerSocket,
+			"threads":       t.threadsPerCore,
+			"isa":           m,
+		}
+		models := []interface{}{}
+		for _, model := range t.models {
+			models = append(models, model)
+		}
+		set(procs, "models", models)
+		if t.mhz > 0 {
+			procs["speed"] = fmt.Sprintf("%.2f GHz", t.mhz/1000)
+		}
+		f["processors"] = procs
+		sys := map[string]interface{}{}
+		total, avail := num(doc, "System.Memory.Total"), num(doc, "System.Memory.Available")
+		usage(sys, "total", total, avail, total-avail)
+		f["memory"] = map[string]interface{}{"system": sys}
+	}
+	if _, ok := doc["Distro"]; ok {
+		os, _ := f["os"].(map[string]interface{})
+		if os == nil {
+			os = map[string]interface{}{}
+			f["os"] = os
+		}
+		name, family, major, minor := distribution(doc)
+		release := map[string]interface{}{"full": str(doc, "Distro.Version")}
+		set(release, "major", major)
+		set(release, "minor", minor)
+		os["name"] = name
+		os["family"] = family
+		os["release"] = release
+		distro := map[string]interface{}{"release": release}
+		set(distro, "id", str(doc, "Distro.Name"))
+		set(distro, "codename", str(doc, "Distro.Codename"))
+		set(distro, "description", str(doc, "Distro.PrettyName"))
+		os["distro"] = distro
+	}
+	if dmi, ok := doc["DMI"]; ok && dmi != nil {
+		d := map[string]interface{}{}
+		sub := func(name string, facts map[string]string) {
+			res := map[string]interface{}{}
+			for fact, path := range facts {
+				set(res, fact, dmiStr(dmi, path))
+			}
+			set(d, name, res)
+		}
+		sub("bios", map[string]string{"vendor": "BIOS.Vendor", "version": "BIOS.BIOSVersion", "release_date": "BIOS.ReleaseDate"})
+		sub("board", map[string]string{"manufacturer": "Baseboards.0.Manufacturer", "product": "Baseboards.0.ProductName",
+			"serial_number": "Baseboards.0.SerialNumber", "asset_tag": "Baseboards.0.AssetTag"})
+		sub("chassis", map[string]string{"type": "Chassis.0.Type", "asset_tag": "Chassis.0.AssetTag"})
+		sub("product", map[string]string{"name": "System.ProductName", "serial_number": "System.SerialNumber", "uuid": "System.UUID"})
+		set(d, "manufacturer", dmiStr(dmi, "System.Manufacturer"))
+		f["dmi"] = d
+		virt, ok := facterVirt[str(dmi, "Hypervisor")]
+		if !ok {
+			virt = "physical"
+		}
+		f["virtual"] = virt
+		f["is_virtual"] = ok
+	}
+	if _, ok := doc["Networking"]; ok {
+		interfaces := map[string]interface{}{}
+		for _, intf := range list(doc, "Networking.Interfaces") {
+			interfaces[str(intf, "Name")] = facterInterface(intf)
+		}
+		net := map[string]interface{}{"interfaces": interfaces}
+		if intf := primary(doc); intf != nil {
+			name := str(intf, "Name")
+			net["primary"] = name
+			for _, k := range []string{"ip", "netmask", "network", "ip6", "netmask6", "network6", "scope6", "mac", "mtu"} {
+				set(net, k, interfaces[name].(map[string]interface{})[k])
+			}
+		}
+		f["networking"] = net
+	}
+	if _, ok := doc["Storage"]; ok {
+		disks := map[string]interface{}{}
+		for _, d := range list(doc, "Storage.Disks") {
+			size := num(d, "Size")
+			res := map[string]interface{}{
+				"size":       human(size, facterUnits),
+				"size_bytes": size,
+				"type":       "ssd",
+			}
+			if flag(d, "Rotational") {
+				res["type"] = "hdd"
+			}
+			set(res, "vendor", dmiStr(d, "Vendor"))
+			set(res, "model", dmiStr(d, "Product"))
+			set(res, "serial", dmiStr(d, "Serial"))
+			disks[disk(d)] = res
+		}
+		f["disks"] = disks
+		mounts := map[string]interface{}{}
+		for _, v := range mounted(doc) {
+			bsize := num(v, "Blocks.Size")
+			total, free, avail := num(v, "Blocks.Total"), num(v, "Blocks.Free"), num(v, "Blocks.Avail")
+			res := map[string]interface{}{
+				"device":     str(v, "BackingDevice"),
+				"filesystem": str(v, "Filesystem"),
+			}
+			options := []interface{}{}
+			for _, o := range strings.Split(str(v, "Options"), ",") {
+				if o != "" {
+					options = append(options, o)
+				}
+			}
+			set(res, "options", options)
+			usage(res, "size", total*bsize, avail*bsize, (total-free)*bsize)
+			mounts[str(v, "Name")] = res
+		}
+		f["mountpoints"] = mounts
+	}
+	return f
+}
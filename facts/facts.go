@@ -0,0 +1,340 @@
+// Package facts writes gohai documents as the facts that Ansible and
+// Puppet's Facter gather, so that gohai can stand in for them on
+// systems without Python or Ruby.
+//
+// Only the facts that can be had from what gohai gathers are written,
+// with the names and layout the Ansible setup module and Facter's core
+// facts use.  Importing the package adds the "ansible" and "facter"
+// formats to the format package.
+package facts
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/rackn/gohai/format"
+)
+
+func init() {
+	format.Register("ansible", "application/json", writer(Ansible))
+	format.Register("facter", "application/json", writer(Facter))
+}
+
+// writer makes a format.Formatter that writes the facts made by fn as
+// indented JSON.
+func writer(fn func(doc map[string]interface{}) map[string]interface{}) format.Formatter {
+	return func(w io.Writer, v interface{}) error {
+		tree, err := format.Tree(v)
+		if err != nil {
+			return err
+		}
+		doc, ok := tree.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Facts can only be written for a whole inventory")
+		}
+		return format.Write(w, "json", fn(doc))
+	}
+}
+
+// get follows a dotted path of fields, or indexes into lists, from v.
+func get(v interface{}, path string) interface{} {
+	for _, part := range strings.Split(path, ".") {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			v = val[part]
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(val) {
+				return nil
+			}
+			v = val[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+func str(v interface{}, path string) string {
+	s, _ := get(v, path).(string)
+	return strings.TrimSpace(s)
+}
+
+func num(v interface{}, path string) int64 {
+	switch n := get(v, path).(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return int64(f)
+	}
+	return 0
+}
+
+func flag(v interface{}, path string) bool {
+	b, _ := get(v, path).(bool)
+	return b
+}
+
+func list(v interface{}, path string) []interface{} {
+	l, _ := get(v, path).([]interface{})
+	return l
+}
+
+// set adds v to m as k, unless it is empty.
+func set(m map[string]interface{}, k string, v interface{}) {
+	switch val := v.(type) {
+	case nil:
+		return
+	case string:
+		if val == "" {
+			return
+		}
+	case map[string]interface{}:
+		if len(val) == 0 {
+			return
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			return
+		}
+	}
+	m[k] = v
+}
+
+// unset are the values firmware fills fields it has nothing for with.
+var unset = map[string]bool{
+	"0":                      true,
+	"none":                   true,
+	"not specified":          true,
+	"unknown":                true,
+	"default string":         true,
+	"to be filled by o.e.m.": true,
+}
+
+// dmiStr is a DMI string, or "" if it is one firmware uses for
+// nothing.
+func dmiStr(v interface{}, path string) string {
+	s := str(v, path)
+	if unset[strings.ToLower(s)] {
+		return ""
+	}
+	return s
+}
+
+// machines are the names uname gives the architectures Go knows.
+var machines = map[string]string{
+	"386":     "i386",
+	"amd64":   "x86_64",
+	"arm":     "armv7l",
+	"arm64":   "aarch64",
+	"ppc64":   "ppc64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+	"riscv64": "riscv64",
+}
+
+// machine is the name uname gives the architecture in doc.
+func machine(doc map[string]interface{}) string {
+	arch := str(doc, "System.Arch")
+	if m, ok := machines[arch]; ok {
+		return m
+	}
+	return arch
+}
+
+// distributions are the names Ansible and Facter give distributions,
+// by their os-release ID.
+var distributions = map[string]string{
+	"ubuntu":              "Ubuntu",
+	"debian":              "Debian",
+	"rhel":                "RedHat",
+	"centos":              "CentOS",
+	"fedora":              "Fedora",
+	"rocky":               "Rocky",
+	"almalinux":           "AlmaLinux",
+	"ol":                  "OracleLinux",
+	"amzn":                "Amazon",
+	"sles":                "SLES",
+	"sled":                "SLED",
+	"opensuse-leap":       "openSUSE Leap",
+	"opensuse-tumbleweed": "openSUSE Tumbleweed",
+	"arch":                "Archlinux",
+	"alpine":              "Alpine",
+}
+
+// osFamilies are the names Ansible and Facter give the families of
+// distributions.
+var osFamilies = map[string]string{
+	"debian": "Debian",
+	"rhel":   "RedHat",
+	"suse":   "Suse",
+	"arch":   "Archlinux",
+	"alpine": "Alpine",
+}
+
+// distribution returns the name and family of the distribution in doc,
+// and its version split into major and minor.
+func distribution(doc map[string]interface{}) (name, family, major, minor string) {
+	name, ok := distributions[str(doc, "Distro.ID")]
+	if !ok {
+		name = str(doc, "Distro.Name")
+	}
+	family, ok = osFamilies[str(doc, "Distro.Family")]
+	if !ok {
+		family = name
+	}
+	parts := strings.SplitN(str(doc, "Distro.Version"), ".", 3)
+	major = parts[0]
+	if len(parts) > 1 {
+		minor = parts[1]
+	}
+	return name, family, major, minor
+}
+
+// topology is how the processors in doc are laid out.
+type topology struct {
+	sockets, coresPerSocket, threadsPerCore, threads int
+	models                                           []string
+	vendors                                          []string
+	mhz                                              float64
+}
+
+func processors(doc map[string]interface{}) topology {
+	res := topology{threads: int(num(doc, "System.ProcessorCount"))}
+	procs := list(doc, "System.Processors")
+	sockets := map[int64]bool{}
+	for _, p := range procs {
+		sockets[num(p, "PhysID")] = true
+		res.models = append(res.models, str(p, "Model"))
+		res.vendors = append(res.vendors, str(p, "Vendor"))
+	}
+	res.sockets = len(sockets)
+	if len(procs) > 0 {
+		p := procs[0]
+		res.coresPerSocket = int(num(p, "Cores"))
+		if siblings := num(p, "Siblings"); res.coresPerSocket > 0 && siblings > 0 {
+			res.threadsPerCore = int(siblings) / res.coresPerSocket
+		}
+		res.mhz, _ = strconv.ParseFloat(str(p, "Speed"), 64)
+	}
+	if topo := get(doc, "System.Topology"); num(topo, "Sockets") > 0 {
+		// The topology from sysfs knows better, particularly on
+		// systems whose /proc/cpuinfo has no physical or core IDs.
+		res.sockets = int(num(topo, "Sockets"))
+		res.coresPerSocket = int(num(topo, "Cores")) / res.sockets
+		res.threadsPerCore = int(num(topo, "ThreadsPerCore"))
+		res.threads = int(num(topo, "Threads"))
+	}
+	if res.coresPerSocket == 0 && res.sockets > 0 {
+		// Nothing says how the threads are shared out, so each is a
+		// core of its own.
+		res.coresPerSocket = len(procs) / res.sockets
+	}
+	if res.threadsPerCore == 0 && res.sockets > 0 {
+		res.threadsPerCore = 1
+	}
+	return res
+}
+
+// binding is an address on an interface.
+type binding struct {
+	ip      net.IP
+	network *net.IPNet
+}
+
+func (b binding) v4() bool {
+	return b.ip.To4() != nil
+}
+
+func (b binding) netmask() string {
+	return net.IP(b.network.Mask).String()
+}
+
+func (b binding) prefix() int {
+	ones, _ := b.network.Mask.Size()
+	return ones
+}
+
+// scope is the scope of an IPv6 address, the way Ansible reports it.
+func (b binding) scope() string {
+	switch {
+	case b.ip.IsLoopback():
+		return "host"
+	case b.ip.IsLinkLocalUnicast():
+		return "link"
+	}
+	return "global"
+}
+
+func bindings(intf interface{}) []binding {
+	res := []binding{}
+	for _, a := range list(intf, "Addrs") {
+		s, _ := a.(string)
+		ip, network, err := net.ParseCIDR(s)
+		if err != nil {
+			continue
+		}
+		res = append(res, binding{ip: ip, network: network})
+	}
+	return res
+}
+
+func hasFlag(intf interface{}, name string) bool {
+	for _, f := range strings.Split(str(intf, "Flags"), "|") {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// primary is the interface the system most likely talks to the world
+// on: the first one that is up with an IPv4 address that is not a
+// loopback one.
+func primary(doc map[string]interface{}) interface{} {
+	for _, intf := range list(doc, "Networking.Interfaces") {
+		if hasFlag(intf, "loopback") || !hasFlag(intf, "up") {
+			continue
+		}
+		for _, b := range bindings(intf) {
+			if b.v4() && !b.ip.IsLoopback() {
+				return intf
+			}
+		}
+	}
+	return nil
+}
+
+// human writes a size the way Facter and Ansible do, in binary units
+// with two decimals.
+func human(bytes int64, units []string) string {
+	v := float64(bytes)
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", v, units[i])
+}
+
+// disk is the name of a disk without /dev.
+func disk(d interface{}) string {
+	return strings.TrimPrefix(str(d, "Name"), "/dev/")
+}
+
+// mounted are the volumes with a filesystem that takes up space.
+func mounted(doc map[string]interface{}) []interface{} {
+	res := []interface{}{}
+	for _, v := range list(doc, "Storage.Volumes") {
+		if num(v, "Blocks.Total") > 0 {
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -0,0 +1,110 @@
+package facts
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rackn/gohai"
+	"github.com/rackn/gohai/format"
+	"github.com/rackn/gohai/internal/fixtures"
+)
+
+func TestFixtures(t *testing.T) {
+	for _, m := range fixtures.Machines(t) {
+		m := m
+		t.Run(m.Name, func(t *testing.T) {
+			inv, err := gohai.Gather(context.Background(), gohai.Options{Root: m.Root})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"ansible", "facter"} {
+				buf := &bytes.Buffer{}
+				if err := format.Write(buf, name, inv); err != nil {
+					t.Fatal(err)
+				}
+				fixtures.Golden(t, filepath.Join("testdata", m.Name+"."+name+".json"), buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestFacts(t *testing.T) {
+	doc := map[string]interface{}{
+		"System": map[string]interface{}{
+			"OS":             "linux",
+			"Arch":           "arm64",
+			"Kernel":         "5.10.0-1057-aws",
+			"ProcessorCount": int64(4),
+			"Processors": []interface{}{
+				map[string]interface{}{"ID": int64(0), "PhysID": int64(0), "Model": "Neoverse-N1"},
+				map[string]interface{}{"ID": int64(1), "PhysID": int64(0), "Model": "Neoverse-N1"},
+				map[string]interface{}{"ID": int64(2), "PhysID": int64(1), "Model": "Neoverse-N1"},
+				map[string]interface{}{"ID": int64(3), "PhysID": int64(1), "Model": "Neoverse-N1"},
+			},
+		},
+		"Distro": map[string]interface{}{
+			"ID": "rocky", "Name": "Rocky Linux", "Version": "8.5", "Codename": "Green Obsidian", "Family": "rhel",
+		},
+		"DMI": map[string]interface{}{
+			"System":     map[string]interface{}{"SerialNumber": "To Be Filled By O.E.M.", "ProductName": "m6g.xlarge"},
+			"Hypervisor": "KVM",
+		},
+		"Networking": map[string]interface{}{
+			"Interfaces": []interface{}{
+				map[string]interface{}{"Name": "lo", "Flags": "up|loopback", "Addrs": []interface{}{"127.0.0.1/8"}},
+				map[string]interface{}{"Name": "eth0", "Flags": "up|broadcast", "Addrs": []interface{}{"2001:db8::5/64", "10.1.2.3/20", "10.1.2.4/20"}},
+			},
+		},
+	}
+	a := Ansible(doc)["ansible_facts"].(map[string]interface{})
+	f := Facter(doc)
+	for _, tc := range []struct {
+		facts map[string]interface{}
+		path  string
+		want  interface{}
+	}{
+		{a, "ansible_architecture", "aarch64"},
+		{a, "ansible_processor_count", 2},
+		{a, "ansible_processor_cores", 2},
+		{a, "ansible_processor_threads_per_core", 1},
+		{a, "ansible_product_serial", "NA"},
+		{a, "ansible_product_name", "m6g.xlarge"},
+		{a, "ansible_virtualization_type", "kvm"},
+		{a, "ansible_eth0.ipv4.broadcast", "10.1.15.255"},
+		{a, "ansible_eth0.ipv4_secondaries.0.address", "10.1.2.4"},
+		{a, "ansible_eth0.ipv6.0.scope", "global"},
+		{a, "ansible_default_ipv4.interface", "eth0"},
+		{a, "ansible_lo.type", "loopback"},
+		{a, "ansible_distribution", "Rocky"},
+		{a, "ansible_os_family", "RedHat"},
+		{a, "ansible_distribution_major_version", "8"},
+		{a, "ansible_distribution_release", "Green Obsidian"},
+		{f, "os.name", "Rocky"},
+		{f, "os.family", "RedHat"},
+		{f, "os.release.minor", "5"},
+		{f, "os.distro.id", "Rocky Linux"},
+		{f, "kernelmajversion", "5.10"},
+		{f, "processors.physicalcount", 2},
+		{f, "virtual", "kvm"},
+		{f, "is_virtual", true},
+		{f, "dmi.product.name", "m6g.xlarge"},
+		{f, "dmi.product.serial_number", nil},
+		{f, "networking.primary", "eth0"},
+		{f, "networking.ip", "10.1.2.3"},
+		{f, "networking.netmask", "255.255.240.0"},
+		{f, "networking.ip6", "2001:db8::5"},
+		{f, "networking.interfaces.eth0.bindings.1.address", "10.1.2.4"},
+	} {
+		if got := get(tc.facts, tc.path); got != tc.want {
+			t.Errorf("%s is %v, want %v", tc.path, got, tc.want)
+		}
+	}
+	if _, ok := a["ansible_devices"]; ok {
+		t.Errorf("Storage facts were written without the Storage class")
+	}
+	if human(1536, facterUnits) != "1.50 KiB" || human(1000, ansibleUnits) != "1000.00 bytes" {
+		t.Errorf("Sizes are %s and %s", human(1536, facterUnits), human(1000, ansibleUnits))
+	}
+}
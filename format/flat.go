@@ -0,0 +1,97 @@
+package format
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	bareKey   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	bareValue = regexp.MustCompile(`^[A-Za-z0-9_.,:/@%+=-]+$`)
+)
+
+// Key returns the flat path of key in the object at prefix.  Keys
+// that are not plain identifiers, like IP addresses, are quoted in
+// brackets, as in Networking.Addrs["10.0.0.1/24"].
+func Key(prefix, key string) string {
+	if !bareKey.MatchString(key) {
+		return prefix + "[" + strconv.Quote(key) + "]"
+	}
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// Index returns the flat path of item i in the array at prefix.
+func Index(prefix string, i int) string {
+	return prefix + "[" + strconv.Itoa(i) + "]"
+}
+
+// Scalar returns the plain text form of a scalar from a Tree.
+// Nulls are empty.
+func Scalar(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return ""
+}
+
+// shellQuote quotes s so that a shell reads it back unchanged.
+func shellQuote(s string) string {
+	if bareValue.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func flatten(w *bufio.Writer, prefix string, v interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			flatten(w, Key(prefix, k), val[k])
+		}
+	case []interface{}:
+		for i := range val {
+			flatten(w, Index(prefix, i), val[i])
+		}
+	default:
+		w.WriteString(prefix)
+		w.WriteByte('=')
+		if val != nil {
+			w.WriteString(shellQuote(Scalar(val)))
+		}
+		w.WriteByte('\n')
+	}
+}
+
+// writeFlat writes a path=value line for every scalar in v, with
+// values quoted the way a shell would need them.  Empty objects and
+// arrays have no lines.
+func writeFlat(w io.Writer, v interface{}) error {
+	tree, err := Tree(v)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	flatten(bw, "", tree)
+	return bw.Flush()
+}
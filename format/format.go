@@ -0,0 +1,182 @@
+// Package format writes what gohai gathered in the output formats it
+// supports.
+//
+// Every format works from the JSON form of the gathered information,
+// so the field names, and the way values like MAC addresses and flags
+// are rendered, are the same no matter which format is picked.
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Formatter writes v to w.
+type Formatter func(w io.Writer, v interface{}) error
+
+var formatters = map[string]Formatter{
+	"json":         writeJSON,
+	"json-compact": writeCompactJSON,
+	"yaml":         writeYAML,
+	"toml":         writeTOML,
+	"flat":         writeFlat,
+}
+
+// Names returns the names of the supported formats, sorted.
+func Names() []string {
+	res := make([]string, 0, len(formatters))
+	for name := range formatters {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Lookup returns the Formatter for the named format.
+func Lookup(name string) (Formatter, error) {
+	if f, ok := formatters[name]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("Unknown format %s, must be one of %v", name, Names())
+}
+
+// contentTypes are the media types of the formats that have one of
+// their own.
+var contentTypes = map[string]string{
+	"json":         "application/json",
+	"json-compact": "application/json",
+	"yaml":         "application/yaml",
+	"toml":         "application/toml",
+}
+
+// ContentType returns the HTTP content type for output in the named
+// format.
+func ContentType(name string) string {
+	if t, ok := contentTypes[name]; ok {
+		return t + "; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Register adds a format that is implemented outside of this package,
+// with the content type to serve it as.  It is meant to be called
+// from init functions.
+func Register(name, contentType string, f Formatter) {
+	if _, ok := formatters[name]; ok {
+		panic(fmt.Sprintf("format: %s already registered", name))
+	}
+	formatters[name] = f
+	if contentType != "" {
+		contentTypes[name] = contentType
+	}
+}
+
+// Write writes v to w in the named format.
+func Write(w io.Writer, name string, v interface{}) error {
+	f, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+	return f(w, v)
+}
+
+// Tree returns the JSON form of v as plain maps, slices, strings,
+// bools and numbers.  Whole numbers are int64 when they fit, and all
+// other numbers are float64.
+func Tree(v interface{}) (interface{}, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var res interface{}
+	if err := dec.Decode(&res); err != nil {
+		return nil, err
+	}
+	return numbers(res), nil
+}
+
+func numbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = numbers(val[k])
+		}
+	case []interface{}:
+		for i := range val {
+			val[i] = numbers(val[i])
+		}
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	}
+	return v
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeCompactJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func writeYAML(w io.Writer, v interface{}) error {
+	tree, err := Tree(v)
+	if err != nil {
+		return err
+	}
+	buf, err := yaml.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// dropNulls removes the nulls TOML has no way of writing.
+func dropNulls(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k := range val {
+			if val[k] == nil {
+				delete(val, k)
+				continue
+			}
+			val[k] = dropNulls(val[k])
+		}
+	case []interface{}:
+		res := make([]interface{}, 0, len(val))
+		for i := range val {
+			if val[i] != nil {
+				res = append(res, dropNulls(val[i]))
+			}
+		}
+		return res
+	}
+	return v
+}
+
+func writeTOML(w io.Writer, v interface{}) error {
+	tree, err := Tree(v)
+	if err != nil {
+		return err
+	}
+	tree = dropNulls(tree)
+	if _, ok := tree.(map[string]interface{}); !ok {
+		return fmt.Errorf("toml can only hold a table, not %T", tree)
+	}
+	return toml.NewEncoder(w).Encode(tree)
+}
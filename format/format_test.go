@@ -0,0 +1,143 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+type sample struct {
+	Name   string
+	IP     net.IP
+	Speed  uint32
+	Ratio  float64
+	Up     bool
+	Tags   []string
+	Addrs  map[string]string
+	Nested []struct{ ID int }
+	Nil    *struct{}
+}
+
+func newSample() map[string]interface{} {
+	s := sample{
+		Name:   "it's eth0",
+		IP:     net.ParseIP("10.0.0.1"),
+		Speed:  4294967295,
+		Ratio:  0.5,
+		Up:     true,
+		Tags:   []string{"a", "b c"},
+		Addrs:  map[string]string{"10.0.0.1/24": "eth0"},
+		Nested: []struct{ ID int }{{1}, {2}},
+	}
+	return map[string]interface{}{"Net": s}
+}
+
+func TestFlat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := Write(buf, "flat", newSample()); err != nil {
+		t.Fatal(err)
+	}
+	want := `Net.Addrs["10.0.0.1/24"]=eth0
+Net.IP=10.0.0.1
+Net.Name='it'\''s eth0'
+Net.Nested[0].ID=1
+Net.Nested[1].ID=2
+Net.Nil=
+Net.Ratio=0.5
+Net.Speed=4294967295
+Net.Tags[0]=a
+Net.Tags[1]='b c'
+Net.Up=true
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRoundTrips(t *testing.T) {
+	want, err := Tree(newSample())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, decode := range map[string]func([]byte) (interface{}, error){
+		"json": func(buf []byte) (interface{}, error) {
+			return Tree(jsonRaw(buf))
+		},
+		"json-compact": func(buf []byte) (interface{}, error) {
+			return Tree(jsonRaw(buf))
+		},
+		"yaml": func(buf []byte) (interface{}, error) {
+			res := map[string]interface{}{}
+			if err := yaml.Unmarshal(buf, &res); err != nil {
+				return nil, err
+			}
+			return Tree(yamlClean(res))
+		},
+		"toml": func(buf []byte) (interface{}, error) {
+			res := map[string]interface{}{}
+			if _, err := toml.Decode(string(buf), &res); err != nil {
+				return nil, err
+			}
+			return Tree(res)
+		},
+	} {
+		buf := &bytes.Buffer{}
+		if err := Write(buf, name, newSample()); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		got, err := decode(buf.Bytes())
+		if err != nil {
+			t.Errorf("%s: failed to read back: %v\n%s", name, err, buf)
+			continue
+		}
+		expect := want
+		if name == "toml" {
+			// TOML cannot hold nulls.
+			expect, _ = Tree(newSample())
+			expect = dropNulls(expect)
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("%s: read back\n%#v\nwant\n%#v", name, got, expect)
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "xml", newSample()); err == nil {
+		t.Errorf("Writing an unknown format succeeded")
+	}
+}
+
+// jsonRaw keeps JSON output as-is so Tree decodes it.
+func jsonRaw(buf []byte) json.RawMessage {
+	return json.RawMessage(buf)
+}
+
+// yamlClean turns the map[interface{}]interface{} that yaml.v2
+// decodes objects into back into something encoding/json handles.
+func yamlClean(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		res := map[string]interface{}{}
+		for k, item := range val {
+			res[fmt.Sprint(k)] = yamlClean(item)
+		}
+		return res
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = yamlClean(val[k])
+		}
+	case []interface{}:
+		for i := range val {
+			val[i] = yamlClean(val[i])
+		}
+	}
+	return v
+}
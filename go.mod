@@ -2,4 +2,8 @@ module github.com/rackn/gohai
 
 go 1.12
 
-require github.com/VictorLowther/godmi v0.6.1
+require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/VictorLowther/godmi v0.6.1
+	gopkg.in/yaml.v2 v2.4.0
+)
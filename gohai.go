@@ -0,0 +1,312 @@
+// Package gohai gathers an inventory of a system: its DMI
+// information, network interfaces, storage, processors and Linux
+// distribution, and the custom facts left on it.
+//
+// It is what the gohai command is built on, for programs that want to
+// gather an inventory themselves:
+//
+//	inv, err := gohai.Gather(ctx, gohai.Options{Only: []string{"Storage.Disks"}})
+//	if err != nil {
+//		return err
+//	}
+//	for _, disk := range inv.Storage.Disks {
+//		fmt.Println(disk.Name, disk.Serial)
+//	}
+//
+// The collectors for each class live in packages under plugins, and
+// can also be used on their own.
+package gohai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/rackn/gohai/capture"
+	"github.com/rackn/gohai/format"
+	"github.com/rackn/gohai/plugins"
+	"github.com/rackn/gohai/plugins/custom"
+	"github.com/rackn/gohai/plugins/distro"
+	"github.com/rackn/gohai/plugins/dmi"
+	"github.com/rackn/gohai/plugins/external"
+	"github.com/rackn/gohai/plugins/net"
+	"github.com/rackn/gohai/plugins/storage"
+	"github.com/rackn/gohai/plugins/system"
+	"github.com/rackn/gohai/schema"
+)
+
+// Options controls what Gather gathers, and how.  The zero Options
+// gathers everything from the running system with no time limits.
+type Options struct {
+	// Root is a filesystem tree, or capture bundle, to gather from
+	// instead of the running system.
+	Root string
+	// Only, if not empty, limits gathering to these classes or class
+	// sections (like "DMI" or "Storage.Disks").  With PluginDir set,
+	// they can also be classes plugins add facts to, or facts in
+	// them (like "Site.Rack").
+	Only []string
+	// Skip leaves out these classes or class sections.
+	Skip []string
+	// Runner runs the external commands collectors need.  It
+	// defaults to running them on the running system, or replaying
+	// them from Root.
+	Runner plugins.Runner
+	// Recorder, if set, is told about everything that is read.
+	Recorder plugins.Recorder
+	// CollectorTimeout limits how long each collector can take.
+	CollectorTimeout time.Duration
+	// Timeout limits how long all of the collectors together can
+	// take.  ctx can also be used for that.
+	Timeout time.Duration
+	// PluginDir, if set, is a directory of external plugins to run.
+	// The classes they add facts to are in the Other classes of the
+	// Inventory.  Plugins are not run when Only only names classes
+	// gohai gathers itself.
+	PluginDir string
+	// PluginTimeout limits how long each plugin can take.
+	PluginTimeout time.Duration
+}
+
+// Inventory is what Gather gathered.  Classes that were not gathered
+// are nil.  Its JSON form is the document the gohai command writes,
+// in the current schema.Version.
+type Inventory struct {
+	DMI        *dmi.Info
+	Distro     *distro.Info
+	Networking *net.Info
+	Storage    *storage.Info
+	System     *system.Info
+	// Custom holds the facts from the fact files on the system.
+	Custom custom.Info
+	// Other holds the classes from collectors registered by other
+	// packages, by class.
+	Other map[string]plugins.Info
+	// Errors and Warnings hold what went wrong while gathering.
+	Errors   []plugins.Problem
+	Warnings []plugins.Problem
+
+	selection plugins.Selection
+}
+
+// Infos returns every class in the Inventory, by class.
+func (inv *Inventory) Infos() map[string]plugins.Info {
+	res := map[string]plugins.Info{}
+	for class, info := range inv.Other {
+		res[class] = info
+	}
+	if inv.DMI != nil {
+		res[inv.DMI.Class()] = inv.DMI
+	}
+	if inv.Distro != nil {
+		res[inv.Distro.Class()] = inv.Distro
+	}
+	if inv.Networking != nil {
+		res[inv.Networking.Class()] = inv.Networking
+	}
+	if inv.Storage != nil {
+		res[inv.Storage.Class()] = inv.Storage
+	}
+	if inv.System != nil {
+		res[inv.System.Class()] = inv.System
+	}
+	if inv.Custom != nil {
+		res[inv.Custom.Class()] = inv.Custom
+	}
+	return res
+}
+
+func (inv *Inventory) add(info plugins.Info) {
+	switch i := info.(type) {
+	case *dmi.Info:
+		inv.DMI = i
+	case *distro.Info:
+		inv.Distro = i
+	case *net.Info:
+		inv.Networking = i
+	case *storage.Info:
+		inv.Storage = i
+	case *system.Info:
+		inv.System = i
+	case custom.Info:
+		inv.Custom = i
+	default:
+		if inv.Other == nil {
+			inv.Other = map[string]plugins.Info{}
+		}
+		inv.Other[info.Class()] = info
+	}
+}
+
+// Tree returns the document the gohai command writes for the
+// Inventory, by class, with the sections that were not selected left
+// out.
+func (inv *Inventory) Tree() (map[string]interface{}, error) {
+	return inv.Document(schema.Version)
+}
+
+// Document returns the JSON form of the document the gohai command
+// writes for the Inventory, in the layout of a schema version.
+func (inv *Inventory) Document(version int) (map[string]interface{}, error) {
+	if err := schema.Check(version); err != nil {
+		return nil, err
+	}
+	env := &plugins.Env{Selection: inv.selection}
+	res := map[string]interface{}{}
+	for class, info := range inv.Infos() {
+		pruned, err := env.Prune(info)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to prune %s: %v", class, err)
+		}
+		res[class] = pruned
+	}
+	if len(inv.Errors) > 0 {
+		res["Errors"] = inv.Errors
+	}
+	if len(inv.Warnings) > 0 {
+		res["Warnings"] = inv.Warnings
+	}
+	res[schema.VersionKey] = schema.Version
+	if version == schema.Version {
+		return res, nil
+	}
+	tree, err := format.Tree(res)
+	if err != nil {
+		return nil, err
+	}
+	doc := tree.(map[string]interface{})
+	return doc, schema.Convert(doc, version)
+}
+
+// MarshalJSON writes the Inventory the way the gohai command does.
+func (inv *Inventory) MarshalJSON() ([]byte, error) {
+	tree, err := inv.Tree()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// classTypes are the Go types of the classes in an Inventory.
+var classTypes = map[string]reflect.Type{
+	"Custom":     reflect.TypeOf(custom.Info{}),
+	"DMI":        reflect.TypeOf(dmi.Info{}),
+	"Distro":     reflect.TypeOf(distro.Info{}),
+	"Networking": reflect.TypeOf(net.Info{}),
+	"Storage":    reflect.TypeOf(storage.Info{}),
+	"System":     reflect.TypeOf(system.Info{}),
+}
+
+// Schema returns the JSON Schema of class in the layout of a schema
+// version, or of the whole document if class is "".
+func Schema(class string, version int) (map[string]interface{}, error) {
+	if class == "" {
+		return schema.Document(classTypes, reflect.TypeOf(plugins.Problem{}), version)
+	}
+	t, ok := classTypes[class]
+	if !ok {
+		return nil, fmt.Errorf("No schema for class %s", class)
+	}
+	return schema.Class(class, t, version)
+}
+
+// Selection returns the classes and sections opts picks, or an error
+// if they are not valid.  Classes no collector is registered for are
+// taken to be ones the plugins in PluginDir add facts to, which Gather
+// checks once they have run, and are only allowed if it is set.
+func (opts Options) Selection() (plugins.Selection, error) {
+	sel := plugins.Selection{Only: opts.Only, Skip: opts.Skip}
+	check := sel
+	if opts.PluginDir != "" {
+		check = sel.Registered()
+	}
+	if err := check.Validate(); err != nil {
+		return sel, fmt.Errorf("Invalid selection: %v", err)
+	}
+	return sel, nil
+}
+
+// Gather gathers an Inventory.  The collectors for each class run at
+// the same time.  Collectors that fail, or do not finish in time, are
+// reported in the Errors of the Inventory, as are the external plugins
+// in PluginDir, which run alongside them.  An error is only returned if
+// the Options are not valid or nothing could be gathered.
+func Gather(ctx context.Context, opts Options) (*Inventory, error) {
+	sel, err := opts.Selection()
+	if err != nil {
+		return nil, err
+	}
+	env := &plugins.Env{
+		Root:      opts.Root,
+		Selection: sel,
+		Runner:    opts.Runner,
+		Recorder:  opts.Recorder,
+	}
+	if fi, err := os.Stat(env.Root); err == nil && fi.Mode().IsRegular() {
+		dir, err := capture.Unpack(env.Root)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unpack capture bundle %s: %v", env.Root, err)
+		}
+		defer os.RemoveAll(dir)
+		env.Root = dir
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	inv := &Inventory{selection: env.Selection}
+	problems := &plugins.Problems{}
+	var (
+		extInfos []*external.Info
+		extErr   error
+	)
+	extDone := make(chan struct{})
+	go func() {
+		defer close(extDone)
+		// Only entries that are not for registered classes are
+		// for the classes plugins add facts to.
+		if opts.PluginDir != "" && (len(sel.Only) == 0 || len(sel.Registered().Only) < len(sel.Only)) {
+			extInfos, extErr = external.Gather(env.WithContext(ctx), opts.PluginDir, opts.PluginTimeout)
+		}
+	}()
+	for _, res := range plugins.RunAll(ctx, env, env.Collectors(), opts.CollectorTimeout) {
+		if res.Err != nil {
+			problems.Add(res.Collector.Class, res.Err)
+		}
+		if res.Info != nil {
+			inv.add(res.Info)
+		}
+	}
+	<-extDone
+	extClasses := []string{}
+	for _, info := range extInfos {
+		extClasses = append(extClasses, info.Class())
+		if sel.Class(info.Class()) {
+			inv.add(info)
+		}
+	}
+	if extErr != nil {
+		problems.Add(external.Class, extErr)
+	}
+	// A class no plugin added is a mistake, unless it could be from
+	// a plugin that failed.
+	if class := sel.Unknown(extClasses); class != "" {
+		if extErr == nil {
+			return nil, fmt.Errorf("Invalid selection: Unknown class %s", class)
+		}
+		problems.Add(external.Class, &plugins.StepError{
+			Step:    "selection",
+			Err:     fmt.Errorf("No plugin added class %s", class),
+			Warning: true,
+		})
+	}
+	inv.Errors, inv.Warnings = problems.Errors, problems.Warnings
+	if len(inv.Infos()) == 0 && !problems.Empty() {
+		return nil, fmt.Errorf("Failed to gather any information: %v", problems.Errors)
+	}
+	return inv, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/rackn/gohai"
+	"github.com/rackn/gohai/capture"
+	"github.com/rackn/gohai/plugins"
+)
+
+// captureMain implements "gohai capture", which gathers everything
+// from the running system and records what was read into a bundle.
+func captureMain(args []string) {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	out := fs.String("o", "",
+		"Write the bundle to this file, or - for stdout (default gohai-capture-HOSTNAME-TIME.tar.gz)")
+	opts := gohai.Options{}
+	timeoutFlags(fs, &opts)
+	pluginFlags(fs, &opts)
+	fs.Parse(args)
+	name := *out
+	if name == "" {
+		host, _ := os.Hostname()
+		name = fmt.Sprintf("gohai-capture-%s-%s.tar.gz", host, time.Now().UTC().Format("20060102T150405Z"))
+	}
+	var dest io.WriteCloser = os.Stdout
+	if name != "-" {
+		f, err := os.Create(name)
+		if err != nil {
+			log.Fatalf("Failed to create capture bundle: %v", err)
+		}
+		dest = f
+	}
+	w := capture.NewWriter(dest)
+	env := &plugins.Env{Recorder: w}
+	platform, _ := json.Marshal(env.Platform())
+	env.SaveArtifact(plugins.PlatformArtifact, platform)
+	opts.Recorder = w
+	inv, err := gohai.Gather(context.Background(), opts)
+	if err != nil {
+		log.Printf("Capture is incomplete: %v", err)
+	} else {
+		// Keep what we made of the system, to compare replays with.
+		buf, _ := json.MarshalIndent(inv, "", "  ")
+		env.SaveArtifact("inventory.json", buf)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatalf("Failed to write capture bundle: %v", err)
+	}
+	if err := dest.Close(); err != nil {
+		log.Fatalf("Failed to write capture bundle: %v", err)
+	}
+	if name != "-" {
+		log.Printf("Wrote capture bundle to %s", name)
+	}
+	if inv != nil && inv.DMI != nil && (len(inv.DMI.Memory.Devices) > 0 || len(inv.DMI.Processors.Items) > 0) {
+		// godmi can only decode the tables of the running system.
+		log.Printf("Replaying the bundle takes DMI from /sys/class/dmi/id, without the memory devices " +
+			"and processors in the SMBIOS tables; they are only in its .gohai/inventory.json")
+	}
+}
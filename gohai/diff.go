@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rackn/gohai/diff"
+	"github.com/rackn/gohai/format"
+)
+
+// diffMain implements "gohai diff", which reports the components that
+// changed between two documents gohai wrote.  Like diff(1), it exits
+// with 1 when there are changes.
+func diffMain(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gohai diff [flags] OLD.json NEW.json\n")
+		fs.PrintDefaults()
+	}
+	all := fs.Bool("all", false,
+		"Include values that change on every run, like free memory and CPU speed")
+	outFormat := fs.String("format", "text",
+		"Output format, text or one of "+strings.Join(format.Names(), ", "))
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var formatter format.Formatter
+	if *outFormat != "text" {
+		var err error
+		if formatter, err = format.Lookup(*outFormat); err != nil {
+			log.Fatal(err)
+		}
+	}
+	old, err := diff.Load(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to load %s: %v", fs.Arg(0), err)
+	}
+	new, err := diff.Load(fs.Arg(1))
+	if err != nil {
+		log.Fatalf("Failed to load %s: %v", fs.Arg(1), err)
+	}
+	changes, err := diff.Compare(old, new, diff.Options{Volatile: *all})
+	if err != nil {
+		log.Fatalf("Failed to compare %s and %s: %v", fs.Arg(0), fs.Arg(1), err)
+	}
+	if formatter == nil {
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+	} else if err := formatter(os.Stdout, map[string]interface{}{"Changes": changes}); err != nil {
+		log.Fatalf("Failed to write %s output: %v", *outFormat, err)
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
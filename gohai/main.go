@@ -1,43 +1,170 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/rackn/gohai/plugins/dmi"
-	"github.com/rackn/gohai/plugins/net"
-	"github.com/rackn/gohai/plugins/storage"
-	"github.com/rackn/gohai/plugins/system"
+	"github.com/rackn/gohai"
+	_ "github.com/rackn/gohai/facts" // for the ansible and facter formats
+	"github.com/rackn/gohai/format"
+	_ "github.com/rackn/gohai/metrics" // for the prometheus format
+	"github.com/rackn/gohai/plugins"
+	"github.com/rackn/gohai/query"
+	"github.com/rackn/gohai/schema"
 )
 
-type info interface {
-	Class() string
+// listFlag is a flag that accepts comma separated values and can be
+// passed more than once.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// timeoutFlags adds the flags that limit how long gathering can
+// take to fs.
+func timeoutFlags(fs *flag.FlagSet, opts *gohai.Options) {
+	fs.DurationVar(&opts.CollectorTimeout, "collector-timeout", 2*time.Minute,
+		"Give up on a collector that takes longer than this (0 for no limit)")
+	fs.DurationVar(&opts.Timeout, "timeout", 5*time.Minute,
+		"Give up on collectors that have not finished after this long (0 for no limit)")
+}
+
+// pluginFlags adds the flags for external plugins to fs.
+func pluginFlags(fs *flag.FlagSet, opts *gohai.Options) {
+	fs.StringVar(&opts.PluginDir, "plugin-dir", "/etc/gohai/plugins",
+		"Run the external plugins in this directory (empty to run none)")
+	fs.DurationVar(&opts.PluginTimeout, "plugin-timeout", 30*time.Second,
+		"Give up on a plugin that takes longer than this (0 for no limit)")
 }
 
 func main() {
-	infos := map[string]info{}
-	dmiInfo, err := dmi.Gather()
-	if err != nil {
-		log.Fatalf("Failed to gather DMI information: %v", err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "capture":
+			captureMain(os.Args[2:])
+			return
+		case "diff":
+			diffMain(os.Args[2:])
+			return
+		case "schema":
+			schemaMain(os.Args[2:])
+			return
+		case "serve":
+			serveMain(os.Args[2:])
+			return
+		}
 	}
-	infos[dmiInfo.Class()] = dmiInfo
-	netInfo, err := net.Gather()
+	opts := gohai.Options{}
+	flag.StringVar(&opts.Root, "root", "/",
+		"Gather from the filesystem tree or capture bundle at this path instead of the running system")
+	flag.Var((*listFlag)(&opts.Only), "only",
+		"Only gather these classes or class sections (like DMI,Storage.Disks)")
+	flag.Var((*listFlag)(&opts.Skip), "skip",
+		"Do not gather these classes or class sections (like Storage.Controllers)")
+	recordDir := flag.String("record-commands", "",
+		"Record the output of external commands like lshw and udevadm in this directory")
+	replayDir := flag.String("replay-commands", "",
+		"Use the command output recorded in this directory instead of running the commands")
+	outFormat := flag.String("format", "json",
+		"Output format, one of "+strings.Join(format.Names(), ", "))
+	timeoutFlags(flag.CommandLine, &opts)
+	pluginFlags(flag.CommandLine, &opts)
+	schemaVersion := flag.Int("schema-version", schema.Version,
+		"Write the output in the layout of this schema version")
+	queryStr := flag.String("query", "",
+		"Only print what this path picks out (like Networking.Interfaces[?Sys.IsPhysical].HardwareAddr)")
+	postClient := postFlags(flag.CommandLine)
+	redactor := redactFlags(flag.CommandLine)
+	flag.Parse()
+	client := postClient()
+	var q *query.Query
+	if *queryStr != "" {
+		var err error
+		if q, err = query.Parse(*queryStr); err != nil {
+			log.Fatal(err)
+		}
+		// There is no need to gather classes the query cannot see.
+		if _, ok := plugins.Lookup(q.Root()); ok && len(opts.Only) == 0 {
+			opts.Only = []string{q.Root()}
+		}
+	}
+	formatter, err := format.Lookup(*outFormat)
 	if err != nil {
-		log.Fatalf("Failed to gather network info: %v", err)
+		log.Fatal(err)
+	}
+	if *replayDir != "" {
+		opts.Runner = plugins.ReplayRunner{Dir: *replayDir}
+	}
+	if *recordDir != "" {
+		var runner plugins.Runner = plugins.ExecRunner{}
+		if opts.Runner != nil {
+			runner = opts.Runner
+		}
+		opts.Runner = plugins.RecordingRunner{Runner: runner, Dir: *recordDir}
 	}
-	infos[netInfo.Class()] = netInfo
-	sysInfo, err := system.Gather()
+	if err := schema.Check(*schemaVersion); err != nil {
+		log.Fatal(err)
+	}
+	inv, err := gohai.Gather(context.Background(), opts)
 	if err != nil {
-		log.Fatalf("Failed to gather basic OS info: %v", err)
+		log.Fatal(err)
 	}
-	infos[sysInfo.Class()] = sysInfo
-	storInfo, err := storage.Gather()
+	doc, err := inv.Document(*schemaVersion)
 	if err != nil {
-		log.Fatalf("Failed to gather storage info: %v", err)
+		log.Fatal(err)
+	}
+	if r := redactor(); r != nil {
+		tree, err := r.Redact(doc)
+		if err != nil {
+			log.Fatalf("Failed to redact the output: %v", err)
+		}
+		doc = tree.(map[string]interface{})
+	}
+	var out interface{} = doc
+	var w io.Writer = os.Stdout
+	buf := &bytes.Buffer{}
+	if client.URL != "" {
+		w = buf
+		client.ContentType = format.ContentType(*outFormat)
+	}
+	if q != nil {
+		res, err := q.Eval(doc)
+		if err != nil {
+			log.Fatalf("Failed to run query %s: %v", q, err)
+		}
+		if res == nil {
+			log.Fatalf("Query %s matched nothing", q)
+		}
+		out = res
+	}
+	// Scalars, and lists of them, that a query picked out are written
+	// as plain text so that scripts can use them as they are.
+	if lines, ok := query.Lines(out); ok && q != nil {
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+		client.ContentType = format.ContentType("text")
+	} else if err := formatter(w, out); err != nil {
+		log.Fatalf("Failed to write %s output: %v", *outFormat, err)
+	}
+	if client.URL != "" {
+		post(client, buf.Bytes())
 	}
-	infos[storInfo.Class()] = storInfo
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	enc.Encode(infos)
 }
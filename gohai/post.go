@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rackn/gohai/push"
+)
+
+// headerFlag is a flag that accepts "Name: value" HTTP headers and can
+// be passed more than once.
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	res := []string{}
+	for k, vals := range h {
+		for _, v := range vals {
+			res = append(res, k+": "+v)
+		}
+	}
+	return strings.Join(res, ", ")
+}
+
+func (h headerFlag) Set(v string) error {
+	parts := strings.SplitN(v, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("Header %q must be written as Name: value", v)
+	}
+	http.Header(h).Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	return nil
+}
+
+// fromEnv returns val, the value of the flag name on fs, or the value
+// of the environment variable env if the flag was not given.  Flags
+// that hold secrets default to the environment this way, rather than
+// with their default value, so that usage messages do not print them.
+// fs must have been parsed.
+func fromEnv(fs *flag.FlagSet, name, env, val string) string {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		given = given || f.Name == name
+	})
+	if given {
+		return val
+	}
+	return os.Getenv(env)
+}
+
+// postFlags adds the flags for posting the output to fs.  The func it
+// returns gives the push.Client they ask for once fs has been parsed.
+// Its URL is empty unless --post was given.
+func postFlags(fs *flag.FlagSet) func() *push.Client {
+	c := &push.Client{Header: http.Header{}}
+	fs.StringVar(&c.URL, "post", "",
+		"POST the output to this URL instead of writing it out")
+	fs.Var(headerFlag(c.Header), "post-header",
+		"Send this header (like 'X-Site: lab1') with the output, can be given more than once")
+	fs.StringVar(&c.Token, "post-token", "",
+		"Send this bearer token with the output (defaults to $GOHAI_POST_TOKEN)")
+	fs.BoolVar(&c.Gzip, "post-gzip", false,
+		"Compress the output with gzip before posting it")
+	fs.IntVar(&c.Retries, "post-retries", 5,
+		"Try posting this many more times if the URL cannot be reached or fails")
+	fs.DurationVar(&c.Backoff, "post-backoff", time.Second,
+		"Wait this long before trying to post again, twice as long each time after that")
+	fs.DurationVar(&c.MaxBackoff, "post-max-backoff", time.Minute,
+		"Never wait longer than this before trying to post again")
+	fs.DurationVar(&c.Timeout, "post-timeout", time.Minute,
+		"Give up on a try at posting that takes longer than this (0 for no limit)")
+	fs.StringVar(&c.SpoolDir, "spool-dir", "",
+		"Keep output that could not be posted in this directory, and post it on the next run")
+	return func() *push.Client {
+		c.Token = fromEnv(fs, "post-token", "GOHAI_POST_TOKEN", c.Token)
+		return c
+	}
+}
+
+// post posts doc with c, and then anything spooled from earlier runs.
+func post(c *push.Client, doc []byte) {
+	ctx := context.Background()
+	if err := c.Post(ctx, doc); err != nil {
+		log.Fatal(err)
+	}
+	if n, err := c.Flush(ctx); err != nil {
+		log.Printf("Posted %d spooled documents: %v", n, err)
+	} else if n > 0 {
+		log.Printf("Posted %d spooled documents", n)
+	}
+}
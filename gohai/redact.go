@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/rackn/gohai/redact"
+)
+
+// redactFlags adds the flags for redacting the output to fs.  The func
+// it returns gives the Redactor they ask for once fs has been parsed,
+// or nil if --redact was not given.
+func redactFlags(fs *flag.FlagSet) func() *redact.Redactor {
+	on := fs.Bool("redact", false,
+		"Replace serial numbers, UUIDs, MAC addresses and IP addresses with stable pseudonyms")
+	key := fs.String("redact-key", "",
+		"Mix this secret into the pseudonyms --redact makes (defaults to $GOHAI_REDACT_KEY)")
+	return func() *redact.Redactor {
+		if !*on {
+			return nil
+		}
+		return &redact.Redactor{Key: []byte(fromEnv(fs, "redact-key", "GOHAI_REDACT_KEY", *key))}
+	}
+}
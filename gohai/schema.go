@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/rackn/gohai"
+	"github.com/rackn/gohai/format"
+	"github.com/rackn/gohai/schema"
+)
+
+// schemaMain implements "gohai schema", which writes the JSON Schema
+// of the output, or of one class in it.
+func schemaMain(args []string) {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gohai schema [flags] [CLASS]\n")
+		fs.PrintDefaults()
+	}
+	version := fs.Int("schema-version", schema.Version,
+		"Write the schema of the layout of this schema version")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	res, err := gohai.Schema(fs.Arg(0), *version)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := format.Write(os.Stdout, "json", res); err != nil {
+		log.Fatalf("Failed to write schema: %v", err)
+	}
+}
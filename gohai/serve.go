@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/rackn/gohai"
+	"github.com/rackn/gohai/schema"
+	"github.com/rackn/gohai/server"
+)
+
+// serveMain implements "gohai serve", which serves the inventory of
+// the system over HTTP.
+func serveMain(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gohai serve [flags]\n")
+		fs.PrintDefaults()
+	}
+	srv := &server.Server{Options: gohai.Options{}}
+	listen := fs.String("listen", ":9100",
+		"Address to listen on")
+	fs.StringVar(&srv.Options.Root, "root", "/",
+		"Gather from the filesystem tree or capture bundle at this path instead of the running system")
+	fs.Var((*listFlag)(&srv.Options.Only), "only",
+		"Only gather these classes or class sections (like DMI,Storage.Disks)")
+	fs.Var((*listFlag)(&srv.Options.Skip), "skip",
+		"Do not gather these classes or class sections (like Storage.Controllers)")
+	fs.DurationVar(&srv.Interval, "refresh", 0,
+		"Gather again this often and serve what was last gathered (0 to gather on every request)")
+	fs.IntVar(&srv.SchemaVersion, "schema-version", schema.Version,
+		"Serve documents in the layout of this schema version")
+	timeoutFlags(fs, &srv.Options)
+	pluginFlags(fs, &srv.Options)
+	redactor := redactFlags(fs)
+	fs.Parse(args)
+	srv.Redactor = redactor()
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := schema.Check(srv.SchemaVersion); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := srv.Options.Selection(); err != nil {
+		log.Fatal(err)
+	}
+	if srv.Interval > 0 {
+		// The first gather happens before listening, so that
+		// broken options are reported straight away.
+		if _, err := srv.Refresh(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		go srv.Run(context.Background())
+	}
+	log.Printf("Serving inventory on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, srv))
+}
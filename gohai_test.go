@@ -0,0 +1,323 @@
+package gohai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rackn/gohai/format"
+	"github.com/rackn/gohai/internal/fixtures"
+	"github.com/rackn/gohai/plugins"
+	"github.com/rackn/gohai/plugins/external"
+	"github.com/rackn/gohai/schema"
+)
+
+func TestGather(t *testing.T) {
+	m := fixtures.Lookup(t, "supermicro-epyc-7232p")
+	inv, err := Gather(context.Background(), Options{
+		Root: m.Root,
+		Only: []string{"Storage.Disks", "System"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.DMI != nil || inv.Networking != nil {
+		t.Errorf("Gathered classes that were not selected")
+	}
+	if inv.System == nil || inv.System.Arch != "amd64" {
+		t.Fatalf("System is %+v", inv.System)
+	}
+	if inv.Storage == nil || len(inv.Storage.Disks) != 3 || inv.Storage.Disks[1].Serial != "ZC1234AB" {
+		t.Fatalf("Storage is %+v", inv.Storage)
+	}
+	if infos := inv.Infos(); len(infos) != 2 || infos["System"] != inv.System {
+		t.Errorf("Infos are %v", infos)
+	}
+	buf, err := json.Marshal(inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	classes := map[string]json.RawMessage{}
+	if err := json.Unmarshal(buf, &classes); err != nil {
+		t.Fatal(err)
+	}
+	if v := string(classes[schema.VersionKey]); v != fmt.Sprint(schema.Version) {
+		t.Errorf("Document has schema version %s", v)
+	}
+	delete(classes, schema.VersionKey)
+	doc := map[string]map[string]interface{}{}
+	for class, raw := range classes {
+		sections := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &sections); err != nil {
+			t.Fatal(err)
+		}
+		doc[class] = sections
+	}
+	if len(doc) != 2 || doc["System"] == nil || doc["Storage"] == nil {
+		t.Errorf("Document has %v", doc)
+	}
+	if _, ok := doc["Storage"]["Volumes"]; ok {
+		t.Errorf("Storage.Volumes was not left out")
+	}
+	if _, ok := doc["Storage"]["Disks"]; !ok {
+		t.Errorf("Storage.Disks was left out")
+	}
+}
+
+func TestGatherErrors(t *testing.T) {
+	m := fixtures.Lookup(t, "docker-container")
+	inv, err := Gather(context.Background(), Options{Root: m.Root, Only: []string{"Storage"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Errors) != 1 || inv.Errors[0].Class != "Storage" || inv.Errors[0].Step != "disks" {
+		t.Errorf("Errors are %+v", inv.Errors)
+	}
+	if _, err := Gather(context.Background(), Options{Only: []string{"Nope"}}); err == nil {
+		t.Errorf("Expected an invalid selection to fail")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Gather(ctx, Options{Root: m.Root}); err == nil {
+		t.Errorf("Expected a cancelled gather to fail")
+	}
+}
+
+func TestGatherPlugins(t *testing.T) {
+	root, err := ioutil.TempDir("", "gohai-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "etc", "gohai", "plugins")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"rack", "broken"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := Options{
+		Root:      root,
+		PluginDir: "/etc/gohai/plugins",
+		Runner: plugins.CannedRunner{
+			"/etc/gohai/plugins/rack":   `{"Site": {"Rack": "r12"}}`,
+			"/etc/gohai/plugins/broken": `{"DMI": {}}`,
+		},
+	}
+	inv, err := Gather(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := inv.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site, ok := doc["Site"].(*external.Info); !ok || site.Facts["Rack"] != "r12" {
+		t.Errorf("Site is %#v", doc["Site"])
+	}
+	found := false
+	for _, p := range inv.Errors {
+		found = found || p.Class == external.Class && p.Step == "broken"
+	}
+	if !found {
+		t.Errorf("broken plugin is not in the errors %+v", inv.Errors)
+	}
+	opts.Only = []string{"System"}
+	if inv, err = Gather(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := inv.Other["Site"]; ok {
+		t.Errorf("Plugins were run with Only set to gohai's own classes")
+	}
+	// The classes plugins add, and the facts in them, can be picked
+	// and left out like gohai's own.
+	for _, tc := range []struct {
+		only, skip []string
+		want       map[string]interface{}
+	}{
+		{[]string{"site"}, nil, map[string]interface{}{"Rack": "r12", "Unit": 14.0}},
+		{[]string{"Site.Rack"}, nil, map[string]interface{}{"Rack": "r12"}},
+		{[]string{"System", "Site"}, []string{"Site.Unit"}, map[string]interface{}{"Rack": "r12"}},
+		{nil, []string{"Site"}, nil},
+	} {
+		opts.Only, opts.Skip = tc.only, tc.skip
+		opts.Runner = plugins.CannedRunner{
+			"/etc/gohai/plugins/rack":   `{"Site": {"Rack": "r12", "Unit": 14}}`,
+			"/etc/gohai/plugins/broken": `{"DMI": {}}`,
+		}
+		inv, err := Gather(context.Background(), opts)
+		if err != nil {
+			t.Errorf("Only %v, skip %v: %v", tc.only, tc.skip, err)
+			continue
+		}
+		doc, err := inv.Tree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]interface{}
+		if site, ok := doc["Site"]; ok {
+			buf, _ := json.Marshal(site)
+			json.Unmarshal(buf, &got)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Only %v, skip %v: Site is %v, want %v", tc.only, tc.skip, got, tc.want)
+		}
+		if _, ok := doc["DMI"]; ok && len(tc.only) > 0 {
+			t.Errorf("Only %v, skip %v: DMI was gathered", tc.only, tc.skip)
+		}
+	}
+	// Classes that no plugin adds are mistakes, unless a plugin that
+	// failed could have added them.
+	opts.Runner = plugins.CannedRunner{
+		"/etc/gohai/plugins/rack":   `{"Site": {"Rack": "r12"}}`,
+		"/etc/gohai/plugins/broken": `{}`,
+	}
+	for _, sel := range [][2][]string{{{"Netwroking"}, nil}, {nil, {"Sytem"}}, {{"System"}, {"Sytem"}}} {
+		opts.Only, opts.Skip = sel[0], sel[1]
+		if _, err := Gather(context.Background(), opts); err == nil {
+			t.Errorf("Only %v, skip %v: no error for a class nothing adds", sel[0], sel[1])
+		}
+	}
+	opts.Only, opts.Skip = nil, []string{"Sytem"}
+	opts.Runner = plugins.CannedRunner{
+		"/etc/gohai/plugins/rack":   `{"Site": {"Rack": "r12"}}`,
+		"/etc/gohai/plugins/broken": `{"DMI": {}}`,
+	}
+	if inv, err = Gather(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	found = false
+	for _, p := range inv.Warnings {
+		found = found || p.Class == external.Class && p.Step == "selection"
+	}
+	if !found {
+		t.Errorf("No warning about Sytem with a broken plugin in %+v", inv.Warnings)
+	}
+	opts.Only, opts.Skip, opts.PluginDir = []string{"Site"}, nil, ""
+	if _, err := Gather(context.Background(), opts); err == nil {
+		t.Errorf("Only named a class with no plugins to add it")
+	}
+}
+
+// validate checks v against the parts of JSON Schema that generated
+// schemas use.
+func validate(t *testing.T, path string, s map[string]interface{}, v interface{}) {
+	t.Helper()
+	if c, ok := s["const"]; ok && fmt.Sprint(c) != fmt.Sprint(v) {
+		t.Errorf("%s is %v, want %v", path, v, c)
+	}
+	types := []string{}
+	switch st := s["type"].(type) {
+	case string:
+		types = append(types, st)
+	case []interface{}:
+		for _, item := range st {
+			types = append(types, item.(string))
+		}
+	}
+	if len(types) == 0 {
+		return
+	}
+	var got string
+	switch v.(type) {
+	case nil:
+		got = "null"
+	case bool:
+		got = "boolean"
+	case int64:
+		got = "integer"
+	case float64:
+		got = "number"
+	case string:
+		got = "string"
+	case []interface{}:
+		got = "array"
+	case map[string]interface{}:
+		got = "object"
+	}
+	ok := false
+	for _, want := range types {
+		ok = ok || want == got || (want == "number" && got == "integer")
+	}
+	if !ok {
+		t.Errorf("%s is %s, want %v", path, got, types)
+		return
+	}
+	switch val := v.(type) {
+	case []interface{}:
+		if items, ok := s["items"].(map[string]interface{}); ok {
+			for i := range val {
+				validate(t, fmt.Sprintf("%s[%d]", path, i), items, val[i])
+			}
+		}
+	case map[string]interface{}:
+		props, _ := s["properties"].(map[string]interface{})
+		extra, _ := s["additionalProperties"].(map[string]interface{})
+		for k := range val {
+			switch {
+			case props != nil:
+				prop, ok := props[k].(map[string]interface{})
+				if !ok {
+					t.Errorf("%s.%s is not in the schema", path, k)
+					continue
+				}
+				validate(t, path+"."+k, prop, val[k])
+			case extra != nil:
+				validate(t, path+"."+k, extra, val[k])
+			}
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	for version := 1; version <= schema.Version; version++ {
+		dir := filepath.Join("schema", fmt.Sprintf("v%d", version))
+		doc, err := Schema("", version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, class := range append([]string{""}, "Custom", "DMI", "Distro", "Networking", "Storage", "System") {
+			s, err := Schema(class, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf, _ := json.MarshalIndent(s, "", "  ")
+			name := class
+			if name == "" {
+				name = "Inventory"
+			}
+			fixtures.Golden(t, filepath.Join(dir, name+".json"), append(buf, '\n'))
+		}
+		// The schema has to match what is written for every machine.
+		buf, _ := json.Marshal(doc)
+		tree, _ := format.Tree(json.RawMessage(buf))
+		for _, m := range fixtures.Machines(t) {
+			inv, err := Gather(context.Background(), Options{Root: m.Root})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := inv.Document(version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := format.Tree(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			validate(t, fmt.Sprintf("%s (v%d)", m.Name, version), tree.(map[string]interface{}), res)
+		}
+	}
+	if _, err := Schema("Nope", schema.Version); err == nil {
+		t.Errorf("Expected a schema for an unknown class to fail")
+	}
+	if _, err := Schema("", schema.Version+1); err == nil {
+		t.Errorf("Expected a schema for an unknown version to fail")
+	}
+}
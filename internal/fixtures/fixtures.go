@@ -0,0 +1,135 @@
+// Package fixtures helps collector tests run against the machine
+// snapshots in testdata/machines at the top of the repository, and
+// compare what they gather with golden files.
+//
+// Each snapshot is a tree laid out the way gohai capture lays out a
+// bundle, so it can also be used with gohai --root.  Run the tests
+// with -update to rewrite the golden files after an intended change
+// in what a collector reports, and review the difference.
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rackn/gohai/plugins"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with what the collectors gather")
+
+// Machine is one of the snapshots in testdata/machines.
+type Machine struct {
+	Name string
+	Root string
+}
+
+// Env returns an Env that gathers from the Machine.
+func (m Machine) Env() *plugins.Env {
+	return &plugins.Env{Root: m.Root}
+}
+
+// Dir returns the directory holding the machine snapshots.
+func Dir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "testdata", "machines")
+}
+
+// Machines returns every machine snapshot.
+func Machines(t *testing.T) []Machine {
+	t.Helper()
+	ents, err := ioutil.ReadDir(Dir())
+	if err != nil {
+		t.Fatalf("Failed to read machine snapshots: %v", err)
+	}
+	res := []Machine{}
+	for _, ent := range ents {
+		if ent.IsDir() {
+			res = append(res, Machine{Name: ent.Name(), Root: filepath.Join(Dir(), ent.Name())})
+		}
+	}
+	if len(res) == 0 {
+		t.Fatalf("No machine snapshots in %s", Dir())
+	}
+	return res
+}
+
+// Lookup returns the named machine snapshot.
+func Lookup(t *testing.T, name string) Machine {
+	t.Helper()
+	for _, m := range Machines(t) {
+		if m.Name == name {
+			return m
+		}
+	}
+	t.Fatalf("No machine snapshot named %s", name)
+	return Machine{}
+}
+
+// result is what is kept in a golden file.
+type result struct {
+	Info     interface{}
+	Errors   []plugins.Problem `json:",omitempty"`
+	Warnings []plugins.Problem `json:",omitempty"`
+}
+
+// Compare checks what a collector for class gathered from m against
+// the golden file.  The Root of m is left out of errors, so golden
+// files do not depend on where the repository is checked out.
+func Compare(t *testing.T, golden string, m Machine, class string, info interface{}, err error) {
+	t.Helper()
+	res := result{Info: info}
+	if err != nil {
+		problems := &plugins.Problems{}
+		problems.Add(class, err)
+		res.Errors, res.Warnings = problems.Errors, problems.Warnings
+	}
+	got, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal %s: %v", class, err)
+	}
+	got = bytes.Replace(got, []byte(m.Root), nil, -1)
+	Golden(t, golden, append(got, '\n'))
+}
+
+// Golden checks got against the golden file, or rewrites the golden
+// file with it when the tests are run with -update.
+func Golden(t *testing.T, golden string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Fatalf("Differs from %s at line %d:\n got: %s\nwant: %s", golden, i+1, g, w)
+		}
+	}
+}
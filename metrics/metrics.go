@@ -0,0 +1,350 @@
+// Package metrics writes the numeric facts in a gohai document as
+// Prometheus metrics, so that the gohai server can be scraped like a
+// node exporter for inventory.
+//
+// Numbers are gauges labelled with what they belong to (disk name and
+// serial number, interface name and MAC address, and so on), and facts
+// that are strings are the labels of *_info gauges that are always 1.
+// Importing the package adds it to the formats in the format package
+// as "prometheus".
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rackn/gohai/format"
+	"github.com/rackn/gohai/query"
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4"
+
+func init() {
+	format.Register("prometheus", ContentType, Write)
+}
+
+// value gets the value of a metric from an item.
+type value func(item map[string]interface{}) (float64, bool)
+
+// label is a label of a metric, and the path to its value in an item.
+type label struct {
+	name, path string
+}
+
+// metric is how one metric is made from a document.
+type metric struct {
+	name, help string
+	// items is a query for the things there is a sample for, like
+	// Storage.Disks[*].
+	items  string
+	labels []label
+	value  value
+}
+
+// field is a value held in a field of an item.  Bools are 0 or 1,
+// and strings are parsed as numbers if they can be.
+func field(path string) value {
+	return func(item map[string]interface{}) (float64, bool) {
+		return number(get(item, path))
+	}
+}
+
+// times is v in units of scale.
+func times(v value, scale float64) value {
+	return func(item map[string]interface{}) (float64, bool) {
+		res, ok := v(item)
+		return res * scale, ok
+	}
+}
+
+// product is the product of the values in two fields of an item.
+func product(a, b string) value {
+	return func(item map[string]interface{}) (float64, bool) {
+		x, ok := number(get(item, a))
+		y, ok2 := number(get(item, b))
+		return x * y, ok && ok2
+	}
+}
+
+// known is a value that is left out when it is 0, or the all ones that
+// drivers use for unknown.
+func known(v value) value {
+	return func(item map[string]interface{}) (float64, bool) {
+		res, ok := v(item)
+		return res, ok && res != 0 && res != math.MaxUint32
+	}
+}
+
+// mounted is a value of a volume that is left out for pseudo
+// filesystems, which have no blocks.
+func mounted(v value) value {
+	return func(item map[string]interface{}) (float64, bool) {
+		if total, ok := number(get(item, "Blocks.Total")); !ok || total == 0 {
+			return 0, false
+		}
+		return v(item)
+	}
+}
+
+// one is the value of info gauges.
+func one(item map[string]interface{}) (float64, bool) {
+	return 1, true
+}
+
+func number(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
+	case bool:
+		if val {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// get follows a dotted path of fields from v.
+func get(v interface{}, path string) interface{} {
+	if path == "" {
+		return v
+	}
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = obj[part]
+	}
+	return v
+}
+
+func l(name, path string) label {
+	return label{name: name, path: path}
+}
+
+var (
+	disk   = []label{l("disk", "Name"), l("serial", "Serial")}
+	intf   = []label{l("interface", "Name"), l("address", "HardwareAddr")}
+	volume = []label{l("volume", "Name"), l("device", "BackingDevice"), l("fstype", "Filesystem")}
+	dimm   = []label{l("locator", "DeviceLocator"), l("bank", "BankLocator"), l("serial", "SerialNumber")}
+)
+
+// metrics are the metrics Write writes.
+var metrics = []metric{
+	{"gohai_system_info", "Operating system, architecture and kernel.",
+		"System", []label{l("os", "OS"), l("arch", "Arch"), l("kernel", "Kernel")}, one},
+	{"gohai_distro_info", "Linux distribution and its version.",
+		"Distro", []label{l("id", "ID"), l("version", "Version"), l("codename", "Codename"), l("family", "Family")}, one},
+	{"gohai_system_memory_total_bytes", "Memory the kernel can use.",
+		"System.Memory", nil, field("Total")},
+	{"gohai_system_memory_free_bytes", "Memory that is not being used.",
+		"System.Memory", nil, field("Free")},
+	{"gohai_system_memory_available_bytes", "Memory available to start new programs.",
+		"System.Memory", nil, field("Available")},
+	{"gohai_system_processors", "Logical processors.",
+		"System", nil, field("ProcessorCount")},
+	{"gohai_system_processor_info", "Logical processors and the cores and sockets they are on.",
+		"System.Processors[*]", []label{l("processor", "ID"), l("package", "PhysID"), l("core", "CoreID"),
+			l("vendor", "Vendor"), l("model", "Model")}, one},
+	{"gohai_system_sockets", "Processor packages.",
+		"System.Topology", nil, field("Sockets")},
+	{"gohai_system_cores", "Physical processor cores.",
+		"System.Topology", nil, field("Cores")},
+	{"gohai_system_cpu_cache_bytes", "Size of each of a kind of CPU cache.",
+		"System.Topology.Caches[*]", []label{l("level", "Level"), l("type", "Type")}, field("Size")},
+	{"gohai_system_cpu_caches", "CPU caches of a kind.",
+		"System.Topology.Caches[*]", []label{l("level", "Level"), l("type", "Type")}, field("Count")},
+	{"gohai_system_numa_memory_total_bytes", "Memory in a NUMA node.",
+		"System.NUMA[*]", []label{l("node", "ID")}, field("Memory.Total")},
+	{"gohai_system_numa_memory_free_bytes", "Memory in a NUMA node that is not being used.",
+		"System.NUMA[*]", []label{l("node", "ID")}, field("Memory.Free")},
+
+	{"gohai_dmi_bios_info", "BIOS vendor, version and release date.",
+		"DMI.BIOS", []label{l("vendor", "Vendor"), l("version", "BIOSVersion"), l("date", "ReleaseDate")}, one},
+	{"gohai_dmi_system_info", "System manufacturer, product and serial number.",
+		"DMI", []label{l("manufacturer", "System.Manufacturer"), l("product", "System.ProductName"),
+			l("serial", "System.SerialNumber"), l("uuid", "System.UUID"), l("hypervisor", "Hypervisor")}, one},
+	{"gohai_dmi_baseboard_info", "Baseboard manufacturer, product and serial number.",
+		"DMI.Baseboards[*]", []label{l("manufacturer", "Manufacturer"), l("product", "ProductName"),
+			l("serial", "SerialNumber")}, one},
+	{"gohai_dmi_processor_cores", "Processor cores.",
+		"DMI.Processors", nil, field("TotalCoreCount")},
+	{"gohai_dmi_processor_enabled_cores", "Processor cores that are enabled.",
+		"DMI.Processors", nil, field("EnabledCoreCount")},
+	{"gohai_dmi_processor_threads", "Processor threads.",
+		"DMI.Processors", nil, field("TotalThreadCount")},
+	{"gohai_dmi_memory_bytes", "Installed memory.",
+		"DMI.Memory", nil, field("Size")},
+	{"gohai_dmi_memory_slots", "Memory slots.",
+		"DMI.Memory", nil, field("TotalSlots")},
+	{"gohai_dmi_memory_populated_slots", "Memory slots with memory in them.",
+		"DMI.Memory", nil, field("PopulatedSlots")},
+	{"gohai_dmi_memory_device_size_bytes", "Size of each memory device.",
+		"DMI.Memory.Devices[*]", append(dimm, l("part", "PartNumber")), field("Size")},
+
+	{"gohai_network_interface_info", "Network interfaces and what they are.",
+		"Networking.Interfaces[*]", append(intf, l("stable_name", "StableName"), l("driver", "Driver"),
+			l("vendor", "Vendor"), l("model", "Model"), l("operstate", "Sys.OperState"), l("type", "Sys.Type")), one},
+	{"gohai_network_interface_physical", "Whether network interfaces are physical.",
+		"Networking.Interfaces[*]", intf, field("Sys.IsPhysical")},
+	{"gohai_network_interface_speed_bytes", "Link speed of network interfaces, in bytes per second.",
+		"Networking.Interfaces[*]", intf, times(known(field("Speed")), 125000)},
+	{"gohai_network_interface_mtu_bytes", "MTU of network interfaces.",
+		"Networking.Interfaces[*]", intf, field("MTU")},
+
+	{"gohai_storage_disk_info", "Disks and what they are.",
+		"Storage.Disks[*]", append(disk, l("vendor", "Vendor"), l("product", "Product"), l("bus", "BusInfo")), one},
+	{"gohai_storage_disk_size_bytes", "Size of disks.",
+		"Storage.Disks[*]", disk, field("Size")},
+	{"gohai_storage_disk_rotational", "Whether disks are rotational.",
+		"Storage.Disks[*]", disk, field("Rotational")},
+	{"gohai_storage_disk_removable", "Whether disks are removable.",
+		"Storage.Disks[*]", disk, field("Removable")},
+	{"gohai_storage_volume_size_bytes", "Size of mounted filesystems.",
+		"Storage.Volumes[*]", volume, mounted(product("Blocks.Total", "Blocks.Size"))},
+	{"gohai_storage_volume_free_bytes", "Free space on mounted filesystems.",
+		"Storage.Volumes[*]", volume, mounted(product("Blocks.Free", "Blocks.Size"))},
+	{"gohai_storage_volume_avail_bytes", "Free space on mounted filesystems that unprivileged users can use.",
+		"Storage.Volumes[*]", volume, mounted(product("Blocks.Avail", "Blocks.Size"))},
+}
+
+// sample is one line of a metric.
+type sample struct {
+	labels []string
+	value  float64
+}
+
+// samples returns the samples of m in doc.
+func (m *metric) samples(doc interface{}) ([]sample, error) {
+	q, err := query.Parse(m.items)
+	if err != nil {
+		return nil, err
+	}
+	found, err := q.Eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := found.([]interface{})
+	if !ok {
+		items = []interface{}{found}
+	}
+	res := []sample{}
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		v, ok := m.value(obj)
+		if !ok {
+			continue
+		}
+		s := sample{value: v}
+		for _, lbl := range m.labels {
+			if val := text(get(obj, lbl.path)); val != "" {
+				s.labels = append(s.labels, lbl.name+`="`+escape(val)+`"`)
+			}
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// text returns a label value as text.
+func text(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// formatValue writes whole numbers without an exponent.
+func formatValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Write writes the metrics in v, the document gohai writes, to w in
+// the Prometheus text format.  Metrics for classes or sections that
+// are not in v are left out.
+func Write(w io.Writer, v interface{}) error {
+	doc, err := format.Tree(v)
+	if err != nil {
+		return err
+	}
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return fmt.Errorf("Prometheus metrics can only be written for a whole inventory")
+	}
+	buf := &strings.Builder{}
+	for i := range metrics {
+		m := &metrics[i]
+		samples, err := m.samples(doc)
+		if err != nil {
+			return fmt.Errorf("Metric %s: %v", m.name, err)
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, s := range samples {
+			buf.WriteString(m.name)
+			if len(s.labels) > 0 {
+				buf.WriteString("{" + strings.Join(s.labels, ",") + "}")
+			}
+			buf.WriteString(" " + formatValue(s.value) + "\n")
+		}
+	}
+	problems := map[string]map[string]int{}
+	for _, kind := range []string{"Errors", "Warnings"} {
+		list, _ := doc.(map[string]interface{})[kind].([]interface{})
+		for _, p := range list {
+			class := text(get(p, "Class"))
+			if problems[kind] == nil {
+				problems[kind] = map[string]int{}
+			}
+			problems[kind][class]++
+		}
+	}
+	writeProblems(buf, "gohai_collector_errors", "Errors collectors ran into.", problems["Errors"])
+	writeProblems(buf, "gohai_collector_warnings", "Warnings collectors ran into.", problems["Warnings"])
+	_, err = io.WriteString(w, buf.String())
+	return err
+}
+
+func writeProblems(w io.Writer, name, help string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	classes := make([]string, 0, len(counts))
+	for class := range counts {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, class := range classes {
+		fmt.Fprintf(w, "%s{class=\"%s\"} %d\n", name, escape(class), counts[class])
+	}
+}
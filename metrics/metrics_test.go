@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/rackn/gohai"
+	"github.com/rackn/gohai/format"
+	"github.com/rackn/gohai/internal/fixtures"
+)
+
+// line is a sample line in the Prometheus text format.
+var line = regexp.MustCompile(`^[a-z_]+(\{[a-z_]+="([^"\\]|\\.)*"(,[a-z_]+="([^"\\]|\\.)*")*\})? -?[0-9.e+]+$`)
+
+func TestFixtures(t *testing.T) {
+	for _, m := range fixtures.Machines(t) {
+		m := m
+		t.Run(m.Name, func(t *testing.T) {
+			inv, err := gohai.Gather(context.Background(), gohai.Options{Root: m.Root})
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			if err := format.Write(buf, "prometheus", inv); err != nil {
+				t.Fatal(err)
+			}
+			seen := map[string]bool{}
+			for _, l := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+				if strings.HasPrefix(l, "# ") {
+					continue
+				}
+				if !line.MatchString(l) {
+					t.Errorf("Bad sample %s", l)
+				}
+				series := l[:strings.LastIndex(l, " ")]
+				if seen[series] {
+					t.Errorf("%s is written more than once", series)
+				}
+				seen[series] = true
+			}
+			fixtures.Golden(t, filepath.Join("testdata", m.Name+".prom"), buf.Bytes())
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	doc := map[string]interface{}{
+		"Storage": map[string]interface{}{
+			"Disks": []interface{}{
+				map[string]interface{}{"Name": "/dev/sda", "Serial": "a\"b\\c\nd", "Size": 4000787030016},
+				map[string]interface{}{"Name": "/dev/sdb", "Size": 1.5},
+			},
+			"Volumes": []interface{}{
+				map[string]interface{}{"Name": "/proc", "Blocks": map[string]interface{}{"Size": 4096, "Total": 0}},
+			},
+		},
+		"Errors": []interface{}{
+			map[string]interface{}{"Class": "Networking", "Step": "ethtool", "Error": "oops"},
+			map[string]interface{}{"Class": "Networking", "Step": "addrs", "Error": "oops"},
+		},
+	}
+	buf := &bytes.Buffer{}
+	if err := Write(buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE gohai_storage_disk_size_bytes gauge\n",
+		`gohai_storage_disk_size_bytes{disk="/dev/sda",serial="a\"b\\c\nd"} 4000787030016` + "\n",
+		`gohai_storage_disk_size_bytes{disk="/dev/sdb"} 1.5` + "\n",
+		`gohai_collector_errors{class="Networking"} 2` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Output does not have %s:\n%s", want, buf)
+		}
+	}
+	for _, unwanted := range []string{"gohai_system", "gohai_storage_volume", "gohai_collector_warnings"} {
+		if strings.Contains(buf.String(), unwanted) {
+			t.Errorf("Output has %s:\n%s", unwanted, buf)
+		}
+	}
+	if err := Write(buf, []string{"not", "an", "inventory"}); err == nil {
+		t.Errorf("Expected writing a list to fail")
+	}
+	if ct := format.ContentType("prometheus"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content type is %s", ct)
+	}
+}
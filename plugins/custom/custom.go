@@ -0,0 +1,162 @@
+// Package custom gathers static facts that provisioning, or an
+// administrator, left on a system in fact files, like the rack, row
+// and role of the machine.
+//
+// Fact files live in Dir, and are JSON (*.json) or YAML (*.yaml or
+// *.yml) objects, or text files (*.txt) with a key=value fact on each
+// line.  The facts in all of them are merged into the Custom class.
+package custom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rackn/gohai/plugins"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	plugins.Register(plugins.Collector{
+		Name:  "custom",
+		Class: "Custom",
+		Gather: func(env *plugins.Env) (plugins.Info, error) {
+			res, err := Gather(env)
+			if res == nil {
+				return nil, err
+			}
+			return res, err
+		},
+	})
+}
+
+// Dir is the directory fact files are read from.
+const Dir = "/etc/gohai/facts.d"
+
+// Info holds the facts from the fact files, by name.
+type Info map[string]interface{}
+
+func (i Info) Class() string {
+	return "Custom"
+}
+
+// stringKeys turns the maps YAML decodes into into the maps JSON
+// does.
+func stringKeys(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			res[fmt.Sprint(k)] = stringKeys(item)
+		}
+		return res
+	case []interface{}:
+		for i := range val {
+			val[i] = stringKeys(val[i])
+		}
+	}
+	return v
+}
+
+// parseText parses key=value lines.  Blank lines and lines starting
+// with # are skipped.
+func parseText(buf []byte) (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	lines := bufio.NewScanner(bytes.NewReader(buf))
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("Line %d is not key=value", n)
+		}
+		res[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return res, lines.Err()
+}
+
+// parse parses the fact file name.  ok is false if it is not a fact
+// file.
+func parse(name string, buf []byte) (facts map[string]interface{}, ok bool, err error) {
+	switch path.Ext(name) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.UseNumber()
+		err = dec.Decode(&facts)
+	case ".yaml", ".yml":
+		var v interface{}
+		if err = yaml.Unmarshal(buf, &v); err == nil && v != nil {
+			var isMap bool
+			if facts, isMap = stringKeys(v).(map[string]interface{}); !isMap {
+				err = fmt.Errorf("Not a YAML mapping")
+			}
+		}
+	case ".txt":
+		facts, err = parseText(buf)
+	default:
+		return nil, false, nil
+	}
+	return facts, true, err
+}
+
+// Gather reads the fact files in Dir, in order of their names.  A fact
+// set by more than one file is a warning, and the last file wins.
+// Files that cannot be parsed are left out, with an error.  If Dir
+// does not exist, or has no fact files, the Info is nil.
+func Gather(env *plugins.Env) (Info, error) {
+	ents, err := env.ReadDir(Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &plugins.StepError{Step: "facts.d", Err: err}
+	}
+	names := []string{}
+	for _, ent := range ents {
+		if ent.Mode().IsRegular() && !strings.HasPrefix(ent.Name(), ".") {
+			names = append(names, ent.Name())
+		}
+	}
+	sort.Strings(names)
+	errs := plugins.Errors{}
+	setBy := map[string]string{}
+	var res Info
+	for _, name := range names {
+		buf, err := env.ReadFile(path.Join(Dir, name))
+		if err != nil {
+			errs.Fail(name, err)
+			continue
+		}
+		facts, ok, err := parse(name, buf)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			errs.Fail(name, err)
+			continue
+		}
+		keys := make([]string, 0, len(facts))
+		for k := range facts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if res == nil {
+			res = Info{}
+		}
+		for _, k := range keys {
+			if prev, ok := setBy[k]; ok {
+				errs.Warn(name, fmt.Errorf("Replaced %s, which %s set", k, prev))
+			}
+			setBy[k] = name
+			res[k] = facts[k]
+		}
+	}
+	return res, errs.Err()
+}
@@ -0,0 +1,77 @@
+package custom
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rackn/gohai/internal/fixtures"
+	"github.com/rackn/gohai/plugins"
+)
+
+func TestFixtures(t *testing.T) {
+	for _, m := range fixtures.Machines(t) {
+		m := m
+		t.Run(m.Name, func(t *testing.T) {
+			info, err := Gather(m.Env())
+			fixtures.Compare(t, filepath.Join("testdata", m.Name+".json"), m, "Custom", info, err)
+		})
+	}
+}
+
+func TestGather(t *testing.T) {
+	root, err := ioutil.TempDir("", "gohai-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, filepath.FromSlash(Dir))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"a.txt":       "rack = r12\n\n# a comment\nrole=web\n",
+		"b.yaml":      "role: db\nlabels:\n  1: one\n  nested: {a: [{b: c}]}\n",
+		"bad.json":    "{",
+		"bad.txt":     "rack\n",
+		"list.yml":    "- a\n- b\n",
+		"empty.yaml":  "",
+		"notes.md":    "role=ignored\n",
+		".hidden.txt": "role=ignored\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := Gather(&plugins.Env{Root: root})
+	buf, _ := json.Marshal(info)
+	if want := `{"labels":{"1":"one","nested":{"a":[{"b":"c"}]}},"rack":"r12","role":"db"}`; string(buf) != want {
+		t.Errorf("Gathered %s, want %s", buf, want)
+	}
+	problems := &plugins.Problems{}
+	problems.Add("Custom", err)
+	got := map[string]string{}
+	for _, p := range problems.Errors {
+		got[p.Step] = p.Error
+	}
+	for step, want := range map[string]string{
+		"bad.json": "unexpected EOF",
+		"bad.txt":  "Line 1 is not key=value",
+		"list.yml": "Not a YAML mapping",
+	} {
+		if got[step] != want {
+			t.Errorf("%s failed with %q, want %q", step, got[step], want)
+		}
+	}
+	if len(got) != 3 {
+		t.Errorf("Errors are %+v", problems.Errors)
+	}
+	if len(problems.Warnings) != 1 || problems.Warnings[0].Error != "Replaced role, which a.txt set" {
+		t.Errorf("Warnings are %+v", problems.Warnings)
+	}
+	if info, err := Gather(&plugins.Env{Root: filepath.Join(root, "missing")}); info != nil || err != nil {
+		t.Errorf("Missing facts.d gave %v, %v", info, err)
+	}
+}
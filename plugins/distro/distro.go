@@ -0,0 +1,299 @@
+// Package distro identifies the Linux distribution a system runs, from
+// /etc/os-release and the release files that came before it.
+package distro
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rackn/gohai/plugins"
+)
+
+func init() {
+	plugins.Register(plugins.Collector{
+		Name:  "distro",
+		Class: "Distro",
+		OS:    []string{"linux"},
+		Gather: func(env *plugins.Env) (plugins.Info, error) {
+			res, err := Gather(env)
+			if res == nil {
+				return nil, err
+			}
+			return res, err
+		},
+	})
+}
+
+// Info is the distribution a system runs.
+type Info struct {
+	// ID is the lower case name of the distribution, like "ubuntu"
+	// or "rhel", as os-release has it.
+	ID string
+	// IDLike are the IDs of the distributions it is derived from.
+	IDLike []string
+	// Name is the name of the distribution, like "Ubuntu".
+	Name string
+	// PrettyName is the name and version, like "Ubuntu 20.04.2 LTS".
+	PrettyName string
+	// Version is the version of the distribution, like "20.04".
+	Version string
+	// Codename is the codename of the version, like "focal".
+	Codename string
+	// Family is the distribution that it and the ones like it
+	// derive from: debian, rhel, suse, arch or alpine.
+	Family string
+	// PackageFormat is the format of its native packages: deb, rpm,
+	// pacman or apk.
+	PackageFormat string
+	// Source is the release file the distribution was identified
+	// from.
+	Source string
+}
+
+func (i *Info) Class() string {
+	return "Distro"
+}
+
+// families are the families of distributions, by the ID of the
+// distributions they are named for or that others are like.
+var families = map[string]string{
+	"debian":   "debian",
+	"ubuntu":   "debian",
+	"rhel":     "rhel",
+	"centos":   "rhel",
+	"fedora":   "rhel",
+	"suse":     "suse",
+	"sles":     "suse",
+	"opensuse": "suse",
+	"arch":     "arch",
+	"alpine":   "alpine",
+}
+
+var packageFormats = map[string]string{
+	"debian": "deb",
+	"rhel":   "rpm",
+	"suse":   "rpm",
+	"arch":   "pacman",
+	"alpine": "apk",
+}
+
+// parseEnv parses the KEY=value lines of os-release and lsb-release.
+// Values can be quoted the way a shell quotes them.
+func parseEnv(buf []byte) map[string]string {
+	res := map[string]string{}
+	lines := bufio.NewScanner(bytes.NewReader(buf))
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		val := strings.TrimSpace(kv[1])
+		switch {
+		case len(val) > 1 && val[0] == '"' && val[len(val)-1] == '"':
+			if unquoted, err := strconv.Unquote(val); err == nil {
+				val = unquoted
+			} else {
+				val = val[1 : len(val)-1]
+			}
+		case len(val) > 1 && val[0] == '\'' && val[len(val)-1] == '\'':
+			val = val[1 : len(val)-1]
+		}
+		res[strings.TrimSpace(kv[0])] = val
+	}
+	return res
+}
+
+// inParens is the last parenthesized part of a version, which is the
+// codename in "7 (Core)" or "11 (bullseye)".
+var inParens = regexp.MustCompile(`\(([^()]+)\)\s*$`)
+
+func (i *Info) fromOSRelease(kv map[string]string) {
+	i.ID = strings.ToLower(kv["ID"])
+	i.IDLike = strings.Fields(strings.ToLower(kv["ID_LIKE"]))
+	i.Name = kv["NAME"]
+	i.PrettyName = kv["PRETTY_NAME"]
+	i.Version = kv["VERSION_ID"]
+	for _, k := range []string{"VERSION_CODENAME", "UBUNTU_CODENAME"} {
+		if i.Codename == "" {
+			i.Codename = kv[k]
+		}
+	}
+	if m := inParens.FindStringSubmatch(kv["VERSION"]); m != nil && i.Codename == "" {
+		i.Codename = m[1]
+	}
+}
+
+// fromLSBRelease fills in what os-release did not have from
+// lsb-release.
+func (i *Info) fromLSBRelease(kv map[string]string) {
+	for _, f := range []struct {
+		field *string
+		key   string
+	}{
+		{&i.ID, "DISTRIB_ID"},
+		{&i.Name, "DISTRIB_ID"},
+		{&i.PrettyName, "DISTRIB_DESCRIPTION"},
+		{&i.Version, "DISTRIB_RELEASE"},
+		{&i.Codename, "DISTRIB_CODENAME"},
+	} {
+		if *f.field == "" {
+			*f.field = kv[f.key]
+		}
+	}
+	i.ID = strings.ToLower(i.ID)
+}
+
+// redhatRelease matches /etc/redhat-release, like "CentOS Linux
+// release 7.9.2009 (Core)".
+var redhatRelease = regexp.MustCompile(`^(.*?)\s+release\s+([0-9][^\s(]*)\s*(?:\((.*)\))?`)
+
+// redhatIDs are the IDs of the distributions that write
+// /etc/redhat-release, by how their names start.
+var redhatIDs = []struct{ prefix, id string }{
+	{"Red Hat Enterprise Linux", "rhel"},
+	{"CentOS", "centos"},
+	{"Fedora", "fedora"},
+	{"Rocky", "rocky"},
+	{"AlmaLinux", "almalinux"},
+	{"Oracle", "ol"},
+	{"Scientific", "scientific"},
+	{"Amazon", "amzn"},
+}
+
+func (i *Info) fromRedHatRelease(buf []byte) {
+	line := strings.TrimSpace(strings.SplitN(string(buf), "\n", 2)[0])
+	i.PrettyName = line
+	i.Name = line
+	if m := redhatRelease.FindStringSubmatch(line); m != nil {
+		i.Name, i.Version, i.Codename = m[1], m[2], m[3]
+	}
+	i.ID = "rhel"
+	for _, r := range redhatIDs {
+		if strings.HasPrefix(i.Name, r.prefix) {
+			i.ID = r.id
+			break
+		}
+	}
+	i.Family = "rhel"
+}
+
+// fromSuSERelease reads /etc/SuSE-release, which has the name of the
+// distribution and then KEY = value lines.
+func (i *Info) fromSuSERelease(buf []byte) {
+	lines := strings.SplitN(string(buf), "\n", 2)
+	i.PrettyName = strings.TrimSpace(lines[0])
+	i.Name = strings.TrimSpace(inParens.ReplaceAllString(i.PrettyName, ""))
+	kv := map[string]string{}
+	if len(lines) > 1 {
+		kv = parseEnv([]byte(lines[1]))
+	}
+	i.Version = kv["VERSION"]
+	if pl := kv["PATCHLEVEL"]; pl != "" && pl != "0" {
+		i.Version += "." + pl
+	}
+	i.Codename = kv["CODENAME"]
+	switch {
+	case strings.Contains(i.Name, "openSUSE"):
+		i.ID = "opensuse"
+	case strings.Contains(i.Name, "Desktop"):
+		i.ID = "sled"
+	default:
+		i.ID = "sles"
+	}
+	i.Family = "suse"
+}
+
+// fromDebianVersion reads /etc/debian_version, which has the version
+// of a release, or the codename of the one being made, like
+// "bookworm/sid".
+func (i *Info) fromDebianVersion(buf []byte) {
+	v := strings.TrimSpace(string(buf))
+	i.ID, i.Name, i.Family = "debian", "Debian GNU/Linux", "debian"
+	if v != "" && v[0] >= '0' && v[0] <= '9' {
+		i.Version = v
+	} else {
+		i.Codename = strings.SplitN(v, "/", 2)[0]
+	}
+	i.PrettyName = strings.TrimSpace(i.Name + " " + v)
+}
+
+// legacy are the release files distributions had before os-release,
+// in the order they are looked for.
+var legacy = []struct {
+	path  string
+	parse func(i *Info, buf []byte)
+}{
+	{"/etc/redhat-release", (*Info).fromRedHatRelease},
+	{"/etc/SuSE-release", (*Info).fromSuSERelease},
+	{"/etc/debian_version", (*Info).fromDebianVersion},
+	{"/etc/arch-release", func(i *Info, buf []byte) {
+		i.ID, i.Name, i.PrettyName, i.Family = "arch", "Arch Linux", "Arch Linux", "arch"
+	}},
+	{"/etc/alpine-release", func(i *Info, buf []byte) {
+		i.ID, i.Name, i.Family = "alpine", "Alpine Linux", "alpine"
+		i.Version = strings.TrimSpace(string(buf))
+		i.PrettyName = i.Name + " v" + i.Version
+	}},
+}
+
+// family returns the family of the distribution, going by its ID and
+// then the IDs of the distributions it is like.
+func (i *Info) family() string {
+	if i.Family != "" {
+		return i.Family
+	}
+	for _, id := range append([]string{i.ID}, i.IDLike...) {
+		if f, ok := families[id]; ok {
+			return f
+		}
+		// Like opensuse-leap and opensuse-tumbleweed.
+		if f, ok := families[strings.SplitN(id, "-", 2)[0]]; ok {
+			return f
+		}
+	}
+	return ""
+}
+
+// Gather identifies the distribution from /etc/os-release (or
+// /usr/lib/os-release), with anything it leaves out filled in from
+// /etc/lsb-release.  Systems without either are identified from the
+// release files distributions had before them.
+func Gather(env *plugins.Env) (*Info, error) {
+	res := &Info{}
+	for _, p := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		if buf, err := env.ReadFile(p); err == nil {
+			res.fromOSRelease(parseEnv(buf))
+			res.Source = p
+			break
+		}
+	}
+	if buf, err := env.ReadFile("/etc/lsb-release"); err == nil {
+		res.fromLSBRelease(parseEnv(buf))
+		if res.Source == "" {
+			res.Source = "/etc/lsb-release"
+		}
+	}
+	if res.ID == "" {
+		for _, l := range legacy {
+			if buf, err := env.ReadFile(l.path); err == nil {
+				l.parse(res, buf)
+				res.Source = l.path
+				break
+			}
+		}
+	}
+	if res.ID == "" {
+		return nil, &plugins.StepError{Step: "release", Err: errors.New("No release file identifies the distribution")}
+	}
+	res.Family = res.family()
+	res.PackageFormat = packageFormats[res.Family]
+	return res, nil
+}
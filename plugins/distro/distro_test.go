@@ -0,0 +1,116 @@
+package distro
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rackn/gohai/internal/fixtures"
+	"github.com/rackn/gohai/plugins"
+)
+
+func TestFixtures(t *testing.T) {
+	for _, m := range fixtures.Machines(t) {
+		m := m
+		t.Run(m.Name, func(t *testing.T) {
+			info, err := Gather(m.Env())
+			fixtures.Compare(t, filepath.Join("testdata", m.Name+".json"), m, "Distro", info, err)
+		})
+	}
+}
+
+func TestReleaseFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		want  Info
+	}{
+		{
+			"rocky",
+			map[string]string{
+				"etc/os-release":     "NAME=\"Rocky Linux\"\nVERSION=\"8.5 (Green Obsidian)\"\nID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\nVERSION_ID=\"8.5\"\nPRETTY_NAME=\"Rocky Linux 8.5 (Green Obsidian)\"\n",
+				"etc/redhat-release": "Rocky Linux release 8.5 (Green Obsidian)\n",
+			},
+			Info{ID: "rocky", IDLike: []string{"rhel", "centos", "fedora"}, Name: "Rocky Linux",
+				PrettyName: "Rocky Linux 8.5 (Green Obsidian)", Version: "8.5", Codename: "Green Obsidian",
+				Family: "rhel", PackageFormat: "rpm", Source: "/etc/os-release"},
+		},
+		{
+			"opensuse-leap",
+			map[string]string{
+				"usr/lib/os-release": "NAME='openSUSE Leap'\nVERSION='15.3'\nID='opensuse-leap'\nID_LIKE='suse opensuse'\nVERSION_ID='15.3'\nPRETTY_NAME='openSUSE Leap 15.3'\n",
+			},
+			Info{ID: "opensuse-leap", IDLike: []string{"suse", "opensuse"}, Name: "openSUSE Leap",
+				PrettyName: "openSUSE Leap 15.3", Version: "15.3", Family: "suse", PackageFormat: "rpm",
+				Source: "/usr/lib/os-release"},
+		},
+		{
+			"lsb-release",
+			map[string]string{
+				"etc/lsb-release":    "DISTRIB_ID=LinuxMint\nDISTRIB_RELEASE=19.3\nDISTRIB_CODENAME=tricia\nDISTRIB_DESCRIPTION=\"Linux Mint 19.3 Tricia\"\n",
+				"etc/debian_version": "buster/sid\n",
+			},
+			Info{ID: "linuxmint", Name: "LinuxMint", PrettyName: "Linux Mint 19.3 Tricia", Version: "19.3",
+				Codename: "tricia", Source: "/etc/lsb-release"},
+		},
+		{
+			"centos6",
+			map[string]string{"etc/redhat-release": "CentOS release 6.10 (Final)\n"},
+			Info{ID: "centos", Name: "CentOS", PrettyName: "CentOS release 6.10 (Final)", Version: "6.10",
+				Codename: "Final", Family: "rhel", PackageFormat: "rpm", Source: "/etc/redhat-release"},
+		},
+		{
+			"rhel6",
+			map[string]string{"etc/redhat-release": "Red Hat Enterprise Linux Server release 6.10 (Santiago)\n"},
+			Info{ID: "rhel", Name: "Red Hat Enterprise Linux Server", Version: "6.10", Codename: "Santiago",
+				PrettyName: "Red Hat Enterprise Linux Server release 6.10 (Santiago)",
+				Family:     "rhel", PackageFormat: "rpm", Source: "/etc/redhat-release"},
+		},
+		{
+			"sles11",
+			map[string]string{"etc/SuSE-release": "SUSE Linux Enterprise Server 11 (x86_64)\nVERSION = 11\nPATCHLEVEL = 4\n"},
+			Info{ID: "sles", Name: "SUSE Linux Enterprise Server 11", PrettyName: "SUSE Linux Enterprise Server 11 (x86_64)",
+				Version: "11.4", Family: "suse", PackageFormat: "rpm", Source: "/etc/SuSE-release"},
+		},
+		{
+			"debian8",
+			map[string]string{"etc/debian_version": "8.11\n"},
+			Info{ID: "debian", Name: "Debian GNU/Linux", PrettyName: "Debian GNU/Linux 8.11", Version: "8.11",
+				Family: "debian", PackageFormat: "deb", Source: "/etc/debian_version"},
+		},
+		{
+			"arch",
+			map[string]string{"etc/arch-release": ""},
+			Info{ID: "arch", Name: "Arch Linux", PrettyName: "Arch Linux", Family: "arch",
+				PackageFormat: "pacman", Source: "/etc/arch-release"},
+		},
+	} {
+		root, err := ioutil.TempDir("", "gohai-distro")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+		for name, content := range tc.files {
+			p := filepath.Join(root, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		info, err := Gather(&plugins.Env{Root: root})
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*info, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, *info, tc.want)
+		}
+	}
+	if _, err := Gather(&plugins.Env{Root: os.TempDir()}); err == nil {
+		t.Errorf("Expected a system without release files to fail")
+	}
+}
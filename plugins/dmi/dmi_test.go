@@ -0,0 +1,44 @@
+package dmi
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/VictorLowther/godmi"
+	"github.com/rackn/gohai/internal/fixtures"
+)
+
+func TestFixtures(t *testing.T) {
+	for _, m := range fixtures.Machines(t) {
+		m := m
+		t.Run(m.Name, func(t *testing.T) {
+			info, err := Gather(m.Env())
+			fixtures.Compare(t, filepath.Join("testdata", m.Name+".json"), m, "DMI", info, err)
+		})
+	}
+}
+
+func TestDetectVirtType(t *testing.T) {
+	for _, tc := range []struct {
+		arch, product, manufacturer, bios, family string
+		want                                      string
+	}{
+		{"amd64", "PowerEdge R630", "Dell Inc.", "Dell Inc.", "", ""},
+		{"amd64", "Standard PC (i440FX + PIIX, 1996)", "QEMU", "SeaBIOS", "", "QEMU"},
+		{"amd64", "KVM", "Red Hat", "SeaBIOS", "", "KVM"},
+		{"amd64", "VMware Virtual Platform", "VMware, Inc.", "Phoenix Technologies LTD", "", "VMware"},
+		{"amd64", "VirtualBox", "innotek GmbH", "innotek GmbH", "", "VirtualBox"},
+		{"amd64", "HVM domU", "Xen", "Xen", "", "Xen"},
+		{"ppc64le", "IBM,8247-22L", "IBM", "IBM", "pSeries LPAR", "LPAR"},
+		{"ppc64le", "9006-22P", "IBM", "", "PowerNV", ""},
+	} {
+		info := &Info{
+			System: &godmi.SystemInformation{ProductName: tc.product, Manufacturer: tc.manufacturer, Family: tc.family},
+			BIOS:   &godmi.BIOSInformation{Vendor: tc.bios},
+		}
+		got, found := detectVirtType(tc.arch, info)
+		if got != tc.want || found != (tc.want != "") {
+			t.Errorf("%s %s: got %q, %v want %q", tc.arch, tc.product, got, found, tc.want)
+		}
+	}
+}
@@ -1,19 +1,13 @@
-// +build ppc64le
-
 package dmi
 
 import (
 	"encoding/json"
-	"os/exec"
 	"strconv"
 
 	"github.com/VictorLowther/godmi"
+	"github.com/rackn/gohai/plugins"
 )
 
-func DetectVirtType(dmiinfo *Info) (string, bool) {
-	return "LPAR", true
-}
-
 func getStringFromMap(data map[string]interface{}, key string) string {
 	if v, ok := data[key].(string); ok {
 		return v
@@ -31,22 +25,36 @@ func chooseNonEmpty(list ...string) string {
 	return ""
 }
 
-func Gather() (res *Info, err error) {
+// gatherLSHW is for systems that usually have no SMBIOS tables, and
+// makes up what it can from what lshw knows.
+func gatherLSHW(env *plugins.Env) (res *Info, err error) {
+	arch := env.Platform().Arch
 	// Just in case they have DMI, use it
-	if gerr := godmi.Init(); gerr == nil {
-		return processDMI()
+	if env.Live() {
+		if env.Recording() {
+			recordTables(env)
+		}
+		if res, err = readSMBIOS(arch); err == nil {
+			return
+		}
 	}
 
 	var jsonOut []byte
-	jsonOut, err = exec.Command("lshw", "-json").Output()
-	if err != nil {
+	jsonOut, err = env.Run("lshw", "-json")
+	if err == plugins.ErrNoCommand && !env.Live() {
+		if res, err = processSysfs(env); err != nil {
+			return nil, &plugins.StepError{Step: "sysfs", Err: err}
+		}
 		return
 	}
+	if err != nil {
+		return nil, &plugins.StepError{Step: "lshw", Err: err}
+	}
 
 	var result map[string]interface{}
 	err = json.Unmarshal(jsonOut, &result)
 	if err != nil {
-		return
+		return nil, &plugins.StepError{Step: "lshw", Err: err}
 	}
 
 	/* Example json blob
@@ -132,7 +140,6 @@ func Gather() (res *Info, err error) {
 	res.Baseboards = bs
 	res.Chassis = []*godmi.ChassisInformation{}
 
-	res.Processors.Items = godmi.ProcessorInformations
 	/* Processor example
 			    "id" : "cpu:1",
 				"class" : "processor",
@@ -170,8 +177,12 @@ func Gather() (res *Info, err error) {
 				}
 			}
 		}
+		// The size is the clock speed in Hz.
 		s := uint16(0)
-		if sv, ok := p["size"].(string); ok {
+		switch sv := p["size"].(type) {
+		case float64:
+			s = uint16(sv / 1000000)
+		case string:
 			i, e := strconv.ParseUint(sv, 10, 64)
 			if e == nil {
 				s = uint16(i / 1000000)
@@ -213,7 +224,6 @@ func Gather() (res *Info, err error) {
 	     "size" : 34359738368
 	   }
 	*/
-	res.Memory.Devices = godmi.MemoryDevices
 	for _, m := range resmem {
 		size, _ := m["size"].(float64)
 		nm := &godmi.MemoryDevice{
@@ -238,6 +248,6 @@ func Gather() (res *Info, err error) {
 			res.Memory.PopulatedSlots += 1
 		}
 	}
-	res.Hypervisor, _ = DetectVirtType(res)
+	res.Hypervisor, _ = detectVirtType(arch, res)
 	return
 }
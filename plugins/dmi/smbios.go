@@ -0,0 +1,112 @@
+package dmi
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/VictorLowther/godmi"
+	"github.com/rackn/gohai/plugins"
+)
+
+// DetectVirtType guesses which hypervisor, if any, the system with
+// dmiinfo is running under.
+func DetectVirtType(dmiinfo *Info) (string, bool) {
+	return detectVirtType(runtime.GOARCH, dmiinfo)
+}
+
+func detectVirtType(arch string, dmiinfo *Info) (string, bool) {
+	if arch == "ppc64le" {
+		// lshw calls bare-metal POWER systems, which run on OPAL
+		// firmware rather than under PowerVM, PowerNV.
+		if strings.HasPrefix(dmiinfo.System.Family, "PowerNV") {
+			return "", false
+		}
+		return "LPAR", true
+	}
+	keys := []string{dmiinfo.System.ProductName, dmiinfo.System.Manufacturer}
+	for _, v := range dmiinfo.Baseboards {
+		keys = append(keys, v.Manufacturer)
+	}
+	keys = append(keys, dmiinfo.BIOS.Vendor)
+	vendors := [][2]string{
+		{"KVM", "KVM"},
+		{"QEMU", "QEMU"},
+		{"VMware", "VMware"},
+		{"VMW", "VMware"},
+		{"innotek GmbH", "VirtualBox"},
+		{"Oracle Corporation", "VirtualBox"},
+		{"Xen", "Xen"},
+		{"Bochs", "Bochs"},
+		{"Parallels", "Parallels"},
+		{"BHYVE", "BHYVE"},
+	}
+	for _, key := range keys {
+		for _, vendor := range vendors {
+			if strings.HasPrefix(key, vendor[0]) {
+				return vendor[1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// recordTables reads the raw SMBIOS tables and their summary in
+// sysfs through env, so that a Recorder gets a copy of what godmi
+// reads on its own.
+func recordTables(env *plugins.Env) {
+	env.ReadFile("/sys/firmware/dmi/tables/smbios_entry_point")
+	env.ReadFile("/sys/firmware/dmi/tables/DMI")
+	processSysfs(env)
+}
+
+func gatherSMBIOS(env *plugins.Env) (res *Info, err error) {
+	if !env.Live() {
+		// godmi can only read the tables of the running system.
+		if res, err = processSysfs(env); err != nil {
+			return nil, &plugins.StepError{Step: "sysfs", Err: err}
+		}
+		return
+	}
+	if env.Recording() {
+		recordTables(env)
+	}
+	if res, err = readSMBIOS(env.Platform().Arch); err != nil {
+		return nil, &plugins.StepError{Step: "smbios", Err: err}
+	}
+	return
+}
+
+// godmiLock keeps more than one gather from using the godmi globals
+// at a time.
+var godmiLock sync.Mutex
+
+// readSMBIOS reads the SMBIOS tables of the running system with
+// godmi.  godmi appends what it decodes to package globals every time
+// it is run, so they are cleared first.
+func readSMBIOS(arch string) (*Info, error) {
+	godmiLock.Lock()
+	defer godmiLock.Unlock()
+	godmi.BIOSInformations = nil
+	godmi.BIOSLanguageInformations = nil
+	godmi.BaseboardInformations = nil
+	godmi.Bit32MemoryErrorInformations = nil
+	godmi.BuiltinPointingDevices = nil
+	godmi.CacheInformations = nil
+	godmi.ChassisInformations = nil
+	godmi.GroupAssociationsList = nil
+	godmi.MemoryDevices = nil
+	godmi.OEMStringsList = nil
+	godmi.PhysicalMemoryArrays = nil
+	godmi.PortInformations = nil
+	godmi.PortableBatterys = nil
+	godmi.ProcessorInformations = nil
+	godmi.SystemConfigurationOptionsList = nil
+	godmi.SystemInformations = nil
+	godmi.SystemPowerSupplys = nil
+	godmi.SystemSlots = nil
+	if err := godmi.Init(); err != nil {
+		return nil, err
+	}
+	return processDMI(arch)
+}
@@ -1,9 +1,32 @@
 package dmi
 
 import (
+	"path"
+	"strconv"
+	"strings"
+
 	"github.com/VictorLowther/godmi"
+	"github.com/rackn/gohai/plugins"
 )
 
+func init() {
+	plugins.Register(plugins.Collector{
+		Name:  "dmi",
+		Class: "DMI",
+		Sections: []string{
+			"BIOS", "System", "Baseboards", "Chassis",
+			"Processors", "Memory", "Hypervisor",
+		},
+		Gather: func(env *plugins.Env) (plugins.Info, error) {
+			res, err := Gather(env)
+			if res == nil {
+				return nil, err
+			}
+			return res, err
+		},
+	})
+}
+
 type Processors struct {
 	TotalCoreCount   uint32
 	EnabledCoreCount uint32
@@ -34,7 +57,17 @@ func (i *Info) Class() string {
 	return "DMI"
 }
 
-func processDMI() (res *Info, err error) {
+// Gather collects the DMI information for the system env refers to.
+func Gather(env *plugins.Env) (*Info, error) {
+	switch env.Platform().Arch {
+	case "ppc64le":
+		return gatherLSHW(env)
+	default:
+		return gatherSMBIOS(env)
+	}
+}
+
+func processDMI(arch string) (res *Info, err error) {
 	res = &Info{}
 	// Filter out bad BIOS records
 	for _, bios := range godmi.BIOSInformations {
@@ -74,6 +107,60 @@ func processDMI() (res *Info, err error) {
 			res.Memory.PopulatedSlots += 1
 		}
 	}
-	res.Hypervisor, _ = DetectVirtType(res)
+	res.Hypervisor, _ = detectVirtType(arch, res)
+	return
+}
+
+// processSysfs builds what it can from the summary of the SMBIOS
+// tables that the kernel leaves in /sys/class/dmi/id.  It is used
+// when the tables themselves cannot be read.
+func processSysfs(env *plugins.Env) (res *Info, err error) {
+	const base = "/sys/class/dmi/id"
+	if _, err = env.Stat(base); err != nil {
+		return nil, err
+	}
+	get := func(name string) string {
+		buf, _ := env.ReadFile(path.Join(base, name))
+		return strings.TrimSpace(string(buf))
+	}
+	chassisType, _ := strconv.ParseUint(get("chassis_type"), 10, 8)
+	res = &Info{
+		BIOS: &godmi.BIOSInformation{
+			Vendor:      get("bios_vendor"),
+			BIOSVersion: get("bios_version"),
+			ReleaseDate: get("bios_date"),
+		},
+		System: &godmi.SystemInformation{
+			Manufacturer: get("sys_vendor"),
+			ProductName:  get("product_name"),
+			Version:      get("product_version"),
+			SerialNumber: get("product_serial"),
+			UUID:         get("product_uuid"),
+			SKUNumber:    get("product_sku"),
+			Family:       get("product_family"),
+		},
+		Baseboards: []*godmi.BaseboardInformation{
+			&godmi.BaseboardInformation{
+				Manufacturer: get("board_vendor"),
+				ProductName:  get("board_name"),
+				Version:      get("board_version"),
+				SerialNumber: get("board_serial"),
+				AssetTag:     get("board_asset_tag"),
+			},
+		},
+		Chassis: []*godmi.ChassisInformation{
+			&godmi.ChassisInformation{
+				Manufacturer: get("chassis_vendor"),
+				Type:         godmi.ChassisType(chassisType),
+				Version:      get("chassis_version"),
+				SerialNumber: get("chassis_serial"),
+				AssetTag:     get("chassis_asset_tag"),
+			},
+		},
+	}
+	res.Processors.Items = []*godmi.ProcessorInformation{}
+	res.Memory.Arrays = []*godmi.PhysicalMemoryArray{}
+	res.Memory.Devices = []*godmi.MemoryDevice{}
+	res.Hypervisor, _ = detectVirtType(env.Platform().Arch, res)
 	return
 }
@@ -0,0 +1,406 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Selection picks the classes, and optionally the sections within a
+// class, that should be gathered.  Entries are either a class name
+// (like "Storage") or a class and one of its sections (like
+// "Storage.Disks").  Names are matched case-insensitively.
+type Selection struct {
+	// Only, if not empty, limits gathering to the listed entries.
+	Only []string
+	// Skip excludes the listed entries.
+	Skip []string
+}
+
+func splitEntry(entry string) (class, section string) {
+	parts := strings.SplitN(entry, ".", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
+// Class returns whether any part of class is selected.
+func (s Selection) Class(class string) bool {
+	for _, entry := range s.Skip {
+		if strings.EqualFold(entry, class) {
+			return false
+		}
+	}
+	if len(s.Only) == 0 {
+		return true
+	}
+	for _, entry := range s.Only {
+		if c, _ := splitEntry(entry); strings.EqualFold(c, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// Section returns whether section of class is selected.
+func (s Selection) Section(class, section string) bool {
+	if !s.Class(class) {
+		return false
+	}
+	for _, entry := range s.Skip {
+		if c, sec := splitEntry(entry); strings.EqualFold(c, class) && strings.EqualFold(sec, section) {
+			return false
+		}
+	}
+	if len(s.Only) == 0 {
+		return true
+	}
+	for _, entry := range s.Only {
+		c, sec := splitEntry(entry)
+		if strings.EqualFold(c, class) && (sec == "" || strings.EqualFold(sec, section)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Partial returns whether only some of the sections of class are
+// selected.
+func (s Selection) Partial(class string) bool {
+	for _, entry := range append(s.Only, s.Skip...) {
+		if c, sec := splitEntry(entry); sec != "" && strings.EqualFold(c, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// registered returns the collector registered for class, whatever
+// its case, or nil if there is none.
+func registered(class string) *Collector {
+	for _, c := range Collectors() {
+		if strings.EqualFold(c.Class, class) {
+			return &c
+		}
+	}
+	return nil
+}
+
+// Registered returns the selection without the entries for classes no
+// collector is registered for, like the ones external plugins add
+// facts to.
+func (s Selection) Registered() Selection {
+	keep := func(entries []string) []string {
+		res := []string{}
+		for _, entry := range entries {
+			if class, _ := splitEntry(entry); registered(class) != nil {
+				res = append(res, entry)
+			}
+		}
+		return res
+	}
+	return Selection{Only: keep(s.Only), Skip: keep(s.Skip)}
+}
+
+// Unknown returns the class of the first entry in the selection that
+// is neither for a registered class nor for one of classes, or "" if
+// there is no such entry.
+func (s Selection) Unknown(classes []string) string {
+	for _, entry := range append(s.Only, s.Skip...) {
+		if class, _ := splitEntry(entry); registered(class) == nil && !matchesFold(classes, class) {
+			return class
+		}
+	}
+	return ""
+}
+
+// Validate checks that every entry in the selection names a
+// registered class and, if present, one of its sections.
+func (s Selection) Validate() error {
+	for _, entry := range append(s.Only, s.Skip...) {
+		class, section := splitEntry(entry)
+		found := registered(class)
+		if found == nil {
+			return fmt.Errorf("Unknown class %s", class)
+		}
+		if section == "" {
+			continue
+		}
+		if !matchesFold(found.Sections, section) {
+			return fmt.Errorf("Unknown section %s in class %s", section, found.Class)
+		}
+	}
+	return nil
+}
+
+func matchesFold(list []string, val string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// Env is the environment a collector gathers information in.  A nil
+// Env gathers everything from the running system.
+type Env struct {
+	// Root is the directory that absolute paths are resolved
+	// against.  It defaults to /, which means that information is
+	// gathered from the running system.  Symlinks under the Root are
+	// resolved as if the Root were /.
+	Root      string
+	Selection Selection
+	// Recorder, if set, is told about everything that is read
+	// through the Env.
+	Recorder Recorder
+	// Runner, if set, runs the external commands collectors need.
+	Runner Runner
+	ctx    context.Context
+}
+
+// Context returns the context of the Env.  Collectors should give up
+// when it is done.  It is never nil.
+func (e *Env) Context() context.Context {
+	if e == nil || e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+// WithContext returns a copy of the Env with its context changed to
+// ctx.
+func (e *Env) WithContext(ctx context.Context) *Env {
+	res := &Env{}
+	if e != nil {
+		*res = *e
+	}
+	res.ctx = ctx
+	return res
+}
+
+// Live returns whether the Env refers to the running system.
+// Collectors should only use syscalls and ioctls that query the
+// kernel directly when it does.
+func (e *Env) Live() bool {
+	return e == nil || e.Root == "" || filepath.Clean(e.Root) == "/"
+}
+
+// Recording returns whether the Env has a Recorder.
+func (e *Env) Recording() bool {
+	return e != nil && e.Recorder != nil
+}
+
+func (e *Env) root() string {
+	if e.Live() {
+		return "/"
+	}
+	return filepath.Clean(e.Root)
+}
+
+// resolve returns p with all symlinks resolved as if the Root was /.
+// The final component is left alone if parent is true.
+func (e *Env) resolve(p string, parent bool) string {
+	if parent {
+		return filepath.Join(e.resolve(filepath.Dir(p), false), filepath.Base(p))
+	}
+	root := e.root()
+	todo := strings.Split(filepath.Clean("/"+p), "/")
+	res := "/"
+	for hops := 0; len(todo) > 0; {
+		comp := todo[0]
+		todo = todo[1:]
+		switch comp {
+		case "", ".":
+			continue
+		case "..":
+			res = filepath.Dir(res)
+			continue
+		}
+		next := filepath.Join(res, comp)
+		res = next
+		if hops > 40 {
+			// Symlink loop, let the OS sort it out.
+			continue
+		}
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			continue
+		}
+		hops++
+		if e.Recording() {
+			e.Recorder.Link(next, target)
+		}
+		if filepath.IsAbs(target) {
+			res = "/"
+		} else {
+			res = filepath.Dir(next)
+		}
+		todo = append(strings.Split(target, "/"), todo...)
+	}
+	return res
+}
+
+// Path returns where p can be found under the Root.
+func (e *Env) Path(p string) string {
+	if e.Live() && !e.Recording() {
+		return p
+	}
+	return filepath.Join(e.root(), e.resolve(p, false))
+}
+
+func (e *Env) rel(host string) string {
+	return filepath.Join("/", strings.TrimPrefix(host, e.root()))
+}
+
+// ReadFile reads the file at p under the Root.
+func (e *Env) ReadFile(p string) ([]byte, error) {
+	host := e.Path(p)
+	buf, err := ioutil.ReadFile(host)
+	if err == nil && e.Recording() {
+		e.Recorder.File(e.rel(host), buf)
+	}
+	return buf, err
+}
+
+// Open opens the file at p under the Root.
+func (e *Env) Open(p string) (io.ReadCloser, error) {
+	if !e.Recording() {
+		return os.Open(e.Path(p))
+	}
+	buf, err := e.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+// ReadDir reads the directory at p under the Root.
+func (e *Env) ReadDir(p string) ([]os.FileInfo, error) {
+	host := e.Path(p)
+	ents, err := ioutil.ReadDir(host)
+	if err != nil || !e.Recording() {
+		return ents, err
+	}
+	dir := e.rel(host)
+	e.Recorder.Dir(dir)
+	for _, ent := range ents {
+		child := filepath.Join(dir, ent.Name())
+		switch {
+		case ent.IsDir():
+			e.Recorder.Dir(child)
+		case ent.Mode()&os.ModeSymlink != 0:
+			if target, err := os.Readlink(filepath.Join(host, ent.Name())); err == nil {
+				e.Recorder.Link(child, target)
+			}
+		}
+	}
+	return ents, nil
+}
+
+// Stat stats the file at p under the Root.  Device nodes that could
+// not be stored in the Root can be recorded as an artifact instead.
+func (e *Env) Stat(p string) (os.FileInfo, error) {
+	host := e.Path(p)
+	fi, err := os.Stat(host)
+	if err != nil {
+		if mode, ok := e.devices()[e.rel(host)]; ok {
+			return deviceInfo{name: filepath.Base(p), mode: mode}, nil
+		}
+		return fi, err
+	}
+	if e.Recording() {
+		switch {
+		case fi.IsDir():
+			e.Recorder.Dir(e.rel(host))
+		case fi.Mode()&os.ModeDevice != 0:
+			e.Recorder.Device(e.rel(host), fi.Mode())
+		case fi.Mode().IsRegular():
+			e.ReadFile(p)
+		}
+	}
+	return fi, err
+}
+
+// Readlink returns the target of the symlink at p under the Root.
+// The target is returned as-is, it is not resolved against the Root.
+func (e *Env) Readlink(p string) (string, error) {
+	if e.Live() && !e.Recording() {
+		return os.Readlink(p)
+	}
+	link := e.resolve(p, true)
+	target, err := os.Readlink(filepath.Join(e.root(), link))
+	if err == nil && e.Recording() {
+		e.Recorder.Link(link, target)
+	}
+	return target, err
+}
+
+// NUMANode returns the NUMA node of the device the sysfs entry at p,
+// like /sys/class/net/eno1 or /sys/block/sda, is for.  That is the
+// numa_node of the nearest device at or above it that has one, which
+// for a disk is the PCI device of its controller.  It is -1 for
+// virtual devices, and where the kernel does not know.
+func (e *Env) NUMANode(p string) int64 {
+	dev := p
+	if target, err := e.Readlink(p); err == nil {
+		dev = filepath.Join(filepath.Dir(p), target)
+		if filepath.IsAbs(target) {
+			dev = target
+		}
+	}
+	for ; strings.HasPrefix(dev, "/sys/devices/"); dev = filepath.Dir(dev) {
+		buf, err := e.ReadFile(filepath.Join(dev, "numa_node"))
+		if err != nil {
+			continue
+		}
+		node, err := strconv.ParseInt(strings.TrimSpace(string(buf)), 10, 64)
+		if err != nil {
+			return -1
+		}
+		return node
+	}
+	return -1
+}
+
+// Wants returns whether section of class should be gathered.
+func (e *Env) Wants(class, section string) bool {
+	if e == nil {
+		return true
+	}
+	return e.Selection.Section(class, section)
+}
+
+// Prune removes the sections of info that were not selected.  If all
+// of them were, info is returned unchanged.
+func (e *Env) Prune(info Info) (interface{}, error) {
+	if e == nil || !e.Selection.Partial(info.Class()) {
+		return info, nil
+	}
+	buf, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]json.RawMessage{}
+	if err := json.Unmarshal(buf, &res); err != nil {
+		return nil, err
+	}
+	for k := range res {
+		if !e.Wants(info.Class(), k) {
+			delete(res, k)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,102 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelection(t *testing.T) {
+	for _, tc := range []struct {
+		sel            Selection
+		class, section string
+		wantClass      bool
+		wantSection    bool
+		wantPartial    bool
+	}{
+		{Selection{}, "Storage", "Disks", true, true, false},
+		{Selection{Only: []string{"storage"}}, "Storage", "Disks", true, true, false},
+		{Selection{Only: []string{"DMI"}}, "Storage", "Disks", false, false, false},
+		{Selection{Only: []string{"Storage.Disks"}}, "Storage", "Disks", true, true, true},
+		{Selection{Only: []string{"Storage.Disks"}}, "Storage", "Volumes", true, false, true},
+		{Selection{Skip: []string{"Storage"}}, "Storage", "Disks", false, false, false},
+		{Selection{Skip: []string{"storage.controllers"}}, "Storage", "Controllers", true, false, true},
+		{Selection{Skip: []string{"Storage.Controllers"}}, "Storage", "Disks", true, true, true},
+		{Selection{Only: []string{"Storage"}, Skip: []string{"Storage.Volumes"}}, "Storage", "Volumes", true, false, true},
+	} {
+		if got := tc.sel.Class(tc.class); got != tc.wantClass {
+			t.Errorf("%+v: Class(%s) = %v, want %v", tc.sel, tc.class, got, tc.wantClass)
+		}
+		if got := tc.sel.Section(tc.class, tc.section); got != tc.wantSection {
+			t.Errorf("%+v: Section(%s, %s) = %v, want %v", tc.sel, tc.class, tc.section, got, tc.wantSection)
+		}
+		if got := tc.sel.Partial(tc.class); got != tc.wantPartial {
+			t.Errorf("%+v: Partial(%s) = %v, want %v", tc.sel, tc.class, got, tc.wantPartial)
+		}
+	}
+}
+
+func TestEnvResolve(t *testing.T) {
+	root, err := ioutil.TempDir("", "gohai-env-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	mustWrite := func(p, content string) {
+		p = filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustLink := func(p, target string) {
+		p = filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite("sys/devices/virtual/net/lo/mtu", "65536\n")
+	mustLink("sys/class/net/lo", "../../devices/virtual/net/lo")
+	// Absolute and escaping links stay under the Root.
+	mustLink("proc/self", "/proc/1234")
+	mustWrite("proc/1234/mounts", "proc /proc proc rw 0 0\n")
+	mustLink("escape", "../../../../../proc/1234")
+	env := &Env{Root: root}
+	for p, want := range map[string]string{
+		"/sys/class/net/lo/mtu": "65536\n",
+		"/proc/self/mounts":     "proc /proc proc rw 0 0\n",
+		"/escape/mounts":        "proc /proc proc rw 0 0\n",
+	} {
+		buf, err := env.ReadFile(p)
+		if err != nil {
+			t.Errorf("%s: %v", p, err)
+			continue
+		}
+		if string(buf) != want {
+			t.Errorf("%s: got %q, want %q", p, buf, want)
+		}
+	}
+	if target, err := env.Readlink("/sys/class/net/lo"); err != nil || target != "../../devices/virtual/net/lo" {
+		t.Errorf("Readlink got %q, %v", target, err)
+	}
+	if _, err := env.ReadFile("/etc/hostname"); !os.IsNotExist(err) {
+		t.Errorf("Reading a file outside the Root got %v", err)
+	}
+}
+
+func TestEnvLive(t *testing.T) {
+	for root, want := range map[string]bool{"": true, "/": true, "//": true, "/tmp/capture": false} {
+		if got := (&Env{Root: root}).Live(); got != want {
+			t.Errorf("Root %q: Live() = %v, want %v", root, got, want)
+		}
+	}
+	if !(*Env)(nil).Live() {
+		t.Errorf("A nil Env is not live")
+	}
+}
@@ -0,0 +1,108 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StepError records the failure of one step of gathering a class of
+// information.  Warnings are failures that only cost some detail,
+// everything else means that a chunk of the class is missing.
+type StepError struct {
+	Step    string
+	Err     error
+	Warning bool
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Errors accumulates the step failures of a collector.  A collector
+// that returns a non-nil Info along with Errors has partially
+// succeeded.
+type Errors []*StepError
+
+func (e Errors) Error() string {
+	res := make([]string, len(e))
+	for i := range e {
+		res[i] = e[i].Error()
+	}
+	return strings.Join(res, "; ")
+}
+
+// Fail records err as an error in step.  Nil errors are ignored.
+func (e *Errors) Fail(step string, err error) {
+	if err != nil {
+		*e = append(*e, &StepError{Step: step, Err: err})
+	}
+}
+
+// Warn records err as a warning in step.  Nil errors are ignored.
+func (e *Errors) Warn(step string, err error) {
+	if err != nil {
+		*e = append(*e, &StepError{Step: step, Err: err, Warning: true})
+	}
+}
+
+// Merge adds the failures in err.  Errors and StepErrors are added
+// as-is, anything else is recorded as an error in an unnamed step.
+func (e *Errors) Merge(err error) {
+	switch v := err.(type) {
+	case nil:
+	case Errors:
+		*e = append(*e, v...)
+	case *StepError:
+		*e = append(*e, v)
+	default:
+		e.Fail("", err)
+	}
+}
+
+// Err returns nil if no failures have been recorded, and e otherwise.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Problem is the reportable form of a StepError.
+type Problem struct {
+	Class string
+	Step  string
+	Error string
+}
+
+// Problems holds everything that went wrong while gathering.
+type Problems struct {
+	Errors   []Problem `json:",omitempty"`
+	Warnings []Problem `json:",omitempty"`
+}
+
+// Add records the failures in err, returned by the collector for
+// class.  Failures without a step are recorded under the "gather" step.
+func (p *Problems) Add(class string, err error) {
+	errs := Errors{}
+	errs.Merge(err)
+	for _, se := range errs {
+		prob := Problem{Class: class, Step: se.Step, Error: se.Err.Error()}
+		if prob.Step == "" {
+			prob.Step = "gather"
+		}
+		if se.Warning {
+			p.Warnings = append(p.Warnings, prob)
+		} else {
+			p.Errors = append(p.Errors, prob)
+		}
+	}
+}
+
+// Empty returns whether no problems have been recorded.
+func (p *Problems) Empty() bool {
+	return len(p.Errors) == 0 && len(p.Warnings) == 0
+}
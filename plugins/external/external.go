@@ -0,0 +1,204 @@
+// Package external runs external plugins: executables, in any
+// language, that print facts gohai does not know how to gather as
+// JSON.  They are how sites add facts of their own, like where a
+// system is racked, without changing gohai.
+//
+// A plugin prints a JSON object with a member for each class it adds
+// facts to, like
+//
+//	{"Site": {"Rack": "r12", "Unit": 14}}
+//
+// Plugins can add to the same class, as long as they set different
+// facts in it.  They cannot add to the classes gohai gathers itself.
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rackn/gohai/plugins"
+	"github.com/rackn/gohai/schema"
+)
+
+// Class is the class failures of plugins are reported under, with the
+// name of the plugin as the step.
+const Class = "Plugins"
+
+// Info is a class that plugins added facts to.
+type Info struct {
+	class string
+	Facts map[string]interface{}
+}
+
+func (i *Info) Class() string {
+	return i.class
+}
+
+func (i *Info) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.Facts)
+}
+
+// output is what a plugin printed.
+type output struct {
+	name    string
+	classes map[string]map[string]interface{}
+}
+
+// reserved returns why class cannot be added to by a plugin, if it
+// cannot be.
+func reserved(class string) string {
+	for _, c := range plugins.Collectors() {
+		if strings.EqualFold(c.Class, class) {
+			return "it is gathered by gohai"
+		}
+	}
+	for _, name := range []string{"Errors", "Warnings", schema.VersionKey, Class} {
+		if strings.EqualFold(name, class) {
+			return "it is reserved"
+		}
+	}
+	if class == "" || strings.Contains(class, ".") {
+		return "it is not a valid class name"
+	}
+	return ""
+}
+
+func classNames(classes map[string]map[string]interface{}) []string {
+	res := make([]string, 0, len(classes))
+	for class := range classes {
+		res = append(res, class)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func factNames(facts map[string]interface{}) []string {
+	res := make([]string, 0, len(facts))
+	for k := range facts {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// run runs the plugin at path, giving up on it after timeout.
+func run(env *plugins.Env, path string, timeout time.Duration) (map[string]map[string]interface{}, error) {
+	ctx := env.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	buf, err := env.WithContext(ctx).Run(path)
+	switch {
+	case err == context.DeadlineExceeded && env.Context().Err() == nil:
+		return nil, fmt.Errorf("Did not finish within %v", timeout)
+	case err != nil:
+		if ee, ok := err.(*exec.ExitError); ok && len(bytes.TrimSpace(ee.Stderr)) > 0 {
+			return nil, fmt.Errorf("%v: %s", err, bytes.TrimSpace(ee.Stderr))
+		}
+		return nil, err
+	}
+	res := map[string]map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(&res); err != nil {
+		return nil, fmt.Errorf("Did not print a JSON object of classes: %v", err)
+	}
+	for class := range res {
+		if why := reserved(class); why != "" {
+			return nil, fmt.Errorf("Cannot add facts to class %q, %s", class, why)
+		}
+	}
+	return res, nil
+}
+
+// Gather runs the plugins in dir, which is under the Root of env, at
+// the same time, and returns the classes they added facts to sorted by
+// class.  Each plugin is given timeout to finish (0 means as long as
+// it needs).  A dir that does not exist has no plugins.  Files in dir
+// whose names start with a dot, and files that are not executable, are
+// not plugins.
+//
+// Plugins that fail, or print something other than classes of facts,
+// are left out and returned as plugins.Errors with their name as the
+// step.  A plugin that sets a fact another plugin already set is a
+// warning; the plugin whose name sorts last wins.
+func Gather(env *plugins.Env, dir string, timeout time.Duration) ([]*Info, error) {
+	errs := plugins.Errors{}
+	ents, err := env.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		errs.Fail("plugins", fmt.Errorf("Failed to read plugin directory: %v", err))
+		return nil, errs
+	}
+	names := []string{}
+	for _, ent := range ents {
+		if !strings.HasPrefix(ent.Name(), ".") {
+			names = append(names, ent.Name())
+		}
+	}
+	sort.Strings(names)
+	outputs := make([]output, len(names))
+	failed := make([]error, len(names))
+	wg := &sync.WaitGroup{}
+	for i, name := range names {
+		fi, err := env.Stat(filepath.Join(dir, name))
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			outputs[i].name = name
+			outputs[i].classes, failed[i] = run(env, filepath.Join(dir, name), timeout)
+		}(i, name)
+	}
+	wg.Wait()
+	classes := map[string]*Info{}
+	setBy := map[string]string{}
+	for i, out := range outputs {
+		switch {
+		case failed[i] == plugins.ErrNoCommand:
+			// Not executable, or not recorded when replaying.
+			continue
+		case failed[i] != nil:
+			errs.Fail(out.name, failed[i])
+			continue
+		}
+		for _, class := range classNames(out.classes) {
+			facts := out.classes[class]
+			info, ok := classes[class]
+			if !ok {
+				info = &Info{class: class, Facts: map[string]interface{}{}}
+				classes[class] = info
+			}
+			for _, k := range factNames(facts) {
+				v := facts[k]
+				fact := class + "." + k
+				if prev, ok := setBy[fact]; ok {
+					errs.Warn(out.name, fmt.Errorf("Replaced %s, which %s set", fact, prev))
+				}
+				setBy[fact] = out.name
+				info.Facts[k] = v
+			}
+		}
+	}
+	res := make([]*Info, 0, len(classes))
+	for _, info := range classes {
+		res = append(res, info)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].class < res[j].class })
+	return res, errs.Err()
+}
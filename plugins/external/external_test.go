@@ -0,0 +1,114 @@
+package external
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rackn/gohai/plugins"
+)
+
+func writePlugins(t *testing.T, dir string, files map[string]string, mode os.FileMode) {
+	t.Helper()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGather(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh command")
+	}
+	dir, err := ioutil.TempDir("", "gohai-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writePlugins(t, dir, map[string]string{
+		"rack":     "#!/bin/sh\necho '{\"Site\": {\"Rack\": \"r12\", \"Unit\": 14}}'\n",
+		"asset":    "#!/bin/sh\necho '{\"Site\": {\"AssetTag\": \"A1\"}, \"Owner\": {\"Team\": \"infra\"}}'\n",
+		"zz-rack":  "#!/bin/sh\necho '{\"Site\": {\"Rack\": \"r13\"}}'\n",
+		"broken":   "#!/bin/sh\necho oops >&2\nexit 3\n",
+		"garbage":  "#!/bin/sh\necho not json\n",
+		"reserved": "#!/bin/sh\necho '{\"errors\": {}}'\n",
+		"slow":     "#!/bin/sh\nexec sleep 10\n",
+		".hidden":  "#!/bin/sh\necho '{\"Hidden\": {}}'\n",
+	}, 0755)
+	writePlugins(t, dir, map[string]string{"README": "Not a plugin"}, 0644)
+	if err := os.Mkdir(filepath.Join(dir, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	infos, err := Gather(nil, dir, 500*time.Millisecond)
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("slow was not killed, Gather took %v", time.Since(start))
+	}
+	errs, ok := err.(plugins.Errors)
+	if !ok {
+		t.Fatalf("Gather returned %v, want plugins.Errors", err)
+	}
+	got := map[string]string{}
+	for _, se := range errs {
+		got[se.Step] = se.Err.Error()
+		if want := se.Step == "zz-rack"; se.Warning != want {
+			t.Errorf("%s is a warning: %v", se.Step, se.Warning)
+		}
+	}
+	for step, want := range map[string]string{
+		"broken":   "exit status 3: oops",
+		"garbage":  "Did not print a JSON object of classes",
+		"reserved": `Cannot add facts to class "errors", it is reserved`,
+		"slow":     "Did not finish within 500ms",
+		"zz-rack":  "Replaced Site.Rack, which rack set",
+	} {
+		if !strings.HasPrefix(got[step], want) {
+			t.Errorf("%s failed with %q, want %q", step, got[step], want)
+		}
+	}
+	if len(got) != 5 {
+		t.Errorf("Failures are %v", got)
+	}
+	buf, err := json.Marshal(map[string]interface{}{infos[0].Class(): infos[0], infos[1].Class(): infos[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Owner":{"Team":"infra"},"Site":{"AssetTag":"A1","Rack":"r13","Unit":14}}`; len(infos) != 2 || string(buf) != want {
+		t.Errorf("Gathered %d classes, %s, want %s", len(infos), buf, want)
+	}
+	if infos, err := Gather(nil, filepath.Join(dir, "missing"), 0); infos != nil || err != nil {
+		t.Errorf("Missing plugin directory gave %v, %v", infos, err)
+	}
+}
+
+func TestGatherReplay(t *testing.T) {
+	root, err := ioutil.TempDir("", "gohai-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "etc", "gohai", "plugins")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Captures do not keep whether files are executable, so every
+	// recorded plugin is replayed.
+	writePlugins(t, dir, map[string]string{"rack": "", "unrecorded": ""}, 0644)
+	env := &plugins.Env{
+		Root:   root,
+		Runner: plugins.CannedRunner{"/etc/gohai/plugins/rack": `{"Site": {"Rack": "r12"}}`},
+	}
+	infos, err := Gather(env, "/etc/gohai/plugins", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Class() != "Site" || infos[0].Facts["Rack"] != "r12" {
+		t.Errorf("Gathered %+v", infos)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"sort"
 	"strings"
 	"unsafe"
+
+	"github.com/rackn/gohai/plugins"
 )
 
 const (
@@ -19,6 +21,21 @@ const (
 
 var endian binary.ByteOrder
 
+func init() {
+	plugins.Register(plugins.Collector{
+		Name:     "net",
+		Class:    "Networking",
+		Sections: []string{"Interfaces", "HardwareAddrs", "Addrs"},
+		Gather: func(env *plugins.Env) (plugins.Info, error) {
+			res, err := Gather(env)
+			if res == nil {
+				return nil, err
+			}
+			return res, err
+		},
+	})
+}
+
 func init() {
 	var i int = 0x1
 	const INT_SIZE int = int(unsafe.Sizeof(0))
@@ -264,6 +281,7 @@ func (n *IPNet) IsCIDR() bool {
 }
 
 type Interface struct {
+	env             *plugins.Env
 	Name            string
 	StableName      string
 	OrdinalName     string
@@ -284,6 +302,7 @@ type Interface struct {
 	Sys             struct {
 		IsPhysical bool
 		BusAddress string
+		NUMANode   int64
 		IfIndex    int64
 		IfLink     int64
 		OperState  string
@@ -333,12 +352,38 @@ func (i *Info) Class() string {
 	return "Networking"
 }
 
-func Gather() (*Info, error) {
+// interfaceAddrs returns the addresses of intf.  They are not in
+// sysfs, so they are recorded as an artifact for replaying later.
+func interfaceAddrs(env *plugins.Env, intf net.Interface) ([]net.Addr, error) {
+	artifact := "addrs/" + intf.Name
+	if !env.Live() {
+		res := []net.Addr{}
+		buf, _ := env.Artifact(artifact)
+		for _, line := range strings.Fields(string(buf)) {
+			if ip, cidr, err := net.ParseCIDR(line); err == nil {
+				res = append(res, &net.IPNet{IP: ip, Mask: cidr.Mask})
+			}
+		}
+		return res, nil
+	}
+	addrs, err := intf.Addrs()
+	if err == nil && env.Recording() {
+		lines := make([]string, len(addrs))
+		for i := range addrs {
+			lines[i] = addrs[i].String() + "\n"
+		}
+		env.SaveArtifact(artifact, []byte(strings.Join(lines, "")))
+	}
+	return addrs, err
+}
+
+func Gather(env *plugins.Env) (*Info, error) {
 	res := &Info{}
-	baseifs, err := net.Interfaces()
+	baseifs, err := interfaces(env)
 	if err != nil {
-		return nil, err
+		return nil, &plugins.StepError{Step: "interfaces", Err: err}
 	}
+	errs := plugins.Errors{}
 	res.Interfaces = make([]Interface, len(baseifs))
 	res.HardwareAddrs = map[string]string{}
 	res.Addrs = map[string]string{}
@@ -355,11 +400,9 @@ func Gather() (*Info, error) {
 		if iface.HardwareAddr != nil && len(iface.HardwareAddr) > 0 {
 			res.HardwareAddrs[iface.HardwareAddr.String()] = iface.Name
 		}
-		addrs, err := intf.Addrs()
-		if err != nil {
-			return nil, err
-		}
 		iface.Addrs = []*IPNet{}
+		addrs, err := interfaceAddrs(env, intf)
+		errs.Warn("addrs "+iface.Name, err)
 		for i := range addrs {
 			addr, ok := addrs[i].(*net.IPNet)
 			if ok {
@@ -367,7 +410,9 @@ func Gather() (*Info, error) {
 				iface.Addrs = append(iface.Addrs, (*IPNet)(addr))
 			}
 		}
-		iface.Fill()
+		if env.Wants(res.Class(), "Interfaces") {
+			errs.Merge(iface.Fill(env))
+		}
 		res.Interfaces[i] = iface
 	}
 	sort.SliceStable(res.Interfaces, func(i, j int) bool { return res.Interfaces[i].Path < res.Interfaces[j].Path })
@@ -381,5 +426,5 @@ func Gather() (*Info, error) {
 			res.Interfaces[i].OrdinalName = fmt.Sprintf("%s:%d", res.Interfaces[i].OrdinalName, 1)
 		}
 	}
-	return res, nil
+	return res, errs.Err()
 }
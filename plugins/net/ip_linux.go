@@ -5,15 +5,19 @@ package net
 import (
 	"bufio"
 	"bytes"
-	"io/ioutil"
-	"os"
-	"os/exec"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
 	"path"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"unsafe"
+
+	"github.com/rackn/gohai/plugins"
 )
 
 type ifReq struct {
@@ -70,9 +74,12 @@ func (i *ifReq) ioctl(cmd uint32, buf []byte) error {
 32..35: partner advertised features
 36..43: reserved
 */
-func (i *Interface) fillGset(buf []byte) error {
-	speedLo := endian.Uint16(buf[12:14])
-	speedHi := endian.Uint16(buf[28:30])
+func (i *Interface) fillGset(order binary.ByteOrder, buf []byte) error {
+	if len(buf) < GSET_SIZE {
+		return fmt.Errorf("GSET result is %d bytes, want %d", len(buf), GSET_SIZE)
+	}
+	speedLo := order.Uint16(buf[12:14])
+	speedHi := order.Uint16(buf[28:30])
 	i.Speed = (uint32(speedHi) << 16) + uint32(speedLo)
 	i.Duplex = buf[14] != 0
 	i.Autonegotiation = buf[18] != 0
@@ -98,11 +105,17 @@ func (i *Interface) fillGset(buf []byte) error {
 48: supported features, advertized features, peer advertised features
 */
 
-func (i *Interface) fillGlink(buf []byte) error {
-	i.Speed = endian.Uint32(buf[4:8])
+func (i *Interface) fillGlink(order binary.ByteOrder, buf []byte) error {
+	if len(buf) < GLINKSETTINGS_SIZE {
+		return fmt.Errorf("GLINKSETTINGS result is %d bytes, want at least %d", len(buf), GLINKSETTINGS_SIZE)
+	}
+	b := int(buf[15]) << 2
+	if want := GLINKSETTINGS_SIZE + 3*b; len(buf) < want {
+		return fmt.Errorf("GLINKSETTINGS result is %d bytes, want %d for %d words of link modes", len(buf), want, buf[15])
+	}
+	i.Speed = order.Uint32(buf[4:8])
 	i.Duplex = buf[8] != 0
 	i.Autonegotiation = buf[11] != 0
-	b := int(buf[15]) << 2
 	s := 48
 	a := 48 + b
 	p := a + b
@@ -113,12 +126,15 @@ func (i *Interface) fillGlink(buf []byte) error {
 }
 
 func (i *Interface) fillUdev() error {
-	cmd := exec.Command("udevadm", "info", "-q", "all", "-p", "/sys/class/net/"+i.Name)
-	buf := &bytes.Buffer{}
-	cmd.Stdout = buf
-	if err := cmd.Run(); err != nil {
+	out, err := i.env.Run("udevadm", "info", "-q", "all", "-p", "/sys/class/net/"+i.Name)
+	if err == plugins.ErrNoCommand && !i.env.Live() {
+		// Not recorded, which is expected for anything but a capture.
+		return nil
+	}
+	if err != nil {
 		return err
 	}
+	buf := bytes.NewBuffer(out)
 	stableNameOrder := []string{"E: ID_NET_NAME_ONBOARD", "E: ID_NET_NAME_SLOT", "E: ID_NET_NAME_PATH"}
 	stableNames := map[string]string{}
 	sc := bufio.NewScanner(buf)
@@ -160,12 +176,73 @@ func (i *Interface) fillUdev() error {
 	return nil
 }
 
+// interfaces returns the network interfaces the Env knows about.
+// Interfaces not on the running system are built from what sysfs
+// has.
+func interfaces(env *plugins.Env) ([]net.Interface, error) {
+	if env.Live() {
+		if env.Recording() {
+			// Record what a replay will need.
+			sysInterfaces(env)
+		}
+		return net.Interfaces()
+	}
+	return sysInterfaces(env)
+}
+
+func sysInterfaces(env *plugins.Env) ([]net.Interface, error) {
+	ents, err := env.ReadDir("/sys/class/net")
+	if err != nil {
+		return nil, err
+	}
+	res := []net.Interface{}
+	for _, ent := range ents {
+		iface := &Interface{env: env, Name: ent.Name()}
+		intf := net.Interface{
+			Index: int(iface.sysInt("ifindex")),
+			MTU:   int(iface.sysInt("mtu")),
+			Name:  iface.Name,
+		}
+		// Like the kernel, treat an all-zero address as no address.
+		if mac, err := net.ParseMAC(iface.sysString("address")); err == nil {
+			for _, b := range mac {
+				if b != 0 {
+					intf.HardwareAddr = mac
+					break
+				}
+			}
+		}
+		flags := iface.sysInt("flags")
+		for bit, flag := range map[int64]net.Flags{
+			syscall.IFF_UP:          net.FlagUp,
+			syscall.IFF_BROADCAST:   net.FlagBroadcast,
+			syscall.IFF_LOOPBACK:    net.FlagLoopback,
+			syscall.IFF_POINTOPOINT: net.FlagPointToPoint,
+			syscall.IFF_MULTICAST:   net.FlagMulticast,
+		} {
+			if flags&bit != 0 {
+				intf.Flags |= flag
+			}
+		}
+		// The kernel works this one out from the operational state.
+		switch iface.sysString("operstate") {
+		case "up", "unknown":
+			if intf.Flags&net.FlagUp != 0 {
+				intf.Flags |= net.FlagRunning
+			}
+		}
+		res = append(res, intf)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Index < res[j].Index })
+	return res, nil
+}
+
 func (i *Interface) sysPath(p string) string {
 	return path.Join("/sys/class/net", i.Name, p)
 }
 
 func (i *Interface) sysString(p string) string {
-	buf, err := ioutil.ReadFile(i.sysPath(p))
+	buf, err := i.env.ReadFile(i.sysPath(p))
 	if err == nil {
 		return strings.TrimSpace(string(buf))
 	}
@@ -178,25 +255,18 @@ func (i *Interface) sysInt(p string) int64 {
 }
 func (i *Interface) sysDir(p string) []string {
 	res := []string{}
-	f, err := os.Open(i.sysPath(p))
+	ents, err := i.env.ReadDir(i.sysPath(p))
 	if err != nil {
 		return res
 	}
-	defer f.Close()
-	ents, err := f.Readdirnames(0)
-	if err != nil {
-		for _, ent := range ents {
-			if ent == "." || ent == ".." {
-				continue
-			}
-			res = append(res, ent)
-		}
+	for _, ent := range ents {
+		res = append(res, ent.Name())
 	}
 	return res
 }
 
 func (i *Interface) sysLink(p string) string {
-	l, _ := os.Readlink(i.sysPath(p))
+	l, _ := i.env.Readlink(i.sysPath(p))
 	return l
 }
 
@@ -205,20 +275,21 @@ func (i *Interface) fillSys() error {
 	link = strings.TrimPrefix(link, "../../devices/")
 	i.Sys.BusAddress = strings.TrimSuffix(link, "/net/"+i.Name)
 	i.Sys.IsPhysical = !strings.HasPrefix(i.Sys.BusAddress, "virtual")
+	i.Sys.NUMANode = i.env.NUMANode(i.sysPath(""))
 	i.Sys.IfIndex = i.sysInt("ifindex")
 	i.Sys.IfLink = i.sysInt("iflink")
 	i.Sys.OperState = i.sysString("operstate")
 	i.Sys.Type = arpHW[i.sysInt("type")]
 	i.Sys.Bridge.Members = []string{}
 	i.Sys.Bond.Members = []string{}
-	if dp := i.sysDir("brport"); dp != nil && len(dp) < 0 {
+	if dp := i.sysDir("brport"); len(dp) > 0 {
 		i.Sys.IsBridge = true
 		i.Sys.Bridge.Master = path.Base(i.sysLink("brport/bridge"))
 	}
 	if i.sysString("bridge/bridge_id") != "" {
 		i.Sys.IsBridge = true
 	}
-	if dp := i.sysDir("brif"); dp != nil && len(dp) < 0 {
+	if dp := i.sysDir("brif"); len(dp) > 0 {
 		i.Sys.Bridge.Members = dp
 	}
 	if sl := i.sysString("bonding/slaves"); sl != "" {
@@ -234,7 +305,7 @@ func (i *Interface) fillSys() error {
 		i.Sys.Bond.LinkState = dp
 		i.Sys.Bond.Master = path.Base(i.sysLink("master"))
 	}
-	if vlan, err := os.Open("/proc/net/vlan/config"); err == nil {
+	if vlan, err := i.env.Open("/proc/net/vlan/config"); err == nil {
 		defer vlan.Close()
 		sc := bufio.NewScanner(vlan)
 		for sc.Scan() {
@@ -250,17 +321,32 @@ func (i *Interface) fillSys() error {
 	return nil
 }
 
-func (i *Interface) Fill() error {
-	if err := i.fillSys(); err != nil {
-		return err
-	}
-	if err := i.fillUdev(); err != nil {
-		return err
-	}
+// Fill populates the interface with what sysfs, udev and ethtool know
+// about it.  A failure in one of them does not stop the others, the
+// returned plugins.Errors has a warning for each one that failed.
+func (i *Interface) Fill(env *plugins.Env) error {
+	i.env = env
+	errs := plugins.Errors{}
+	errs.Warn("sysfs "+i.Name, i.fillSys())
+	errs.Warn("udev "+i.Name, i.fillUdev())
+	errs.Warn("ethtool "+i.Name, i.fillEthtool())
+	return errs.Err()
+}
+
+// ethtoolResult is what an ethtool ioctl returned.  It is recorded
+// as an artifact so that it can be replayed on another system.
+type ethtoolResult struct {
+	Cmd       uint32
+	BigEndian bool
+	Data      []byte
+}
+
+func (r *ethtoolResult) query(name string) error {
+	r.BigEndian = endian == binary.BigEndian
 	// First, try GLINKSETTINGS
 	buf := make([]byte, 4096)
 	req := &ifReq{}
-	req.SetName(i.Name)
+	req.SetName(name)
 	err := req.ioctl(CMD_GLINKSETTINGS, buf)
 	if err == nil {
 		// We support GLINKSETTINGS, figure out how much space is needed for
@@ -273,10 +359,52 @@ func (i *Interface) Fill() error {
 		if err := req.ioctl(CMD_GLINKSETTINGS, buf); err != nil {
 			return err
 		}
-		return i.fillGlink(buf)
+		r.Cmd = CMD_GLINKSETTINGS
+		r.Data = buf[:GLINKSETTINGS_SIZE+3*(int(buf[15])<<2)]
+		return nil
 	}
 	if err := req.ioctl(CMD_GSET, buf); err != nil {
+		if err == syscall.EOPNOTSUPP {
+			// Lots of virtual interfaces have no link settings.
+			return nil
+		}
 		return err
 	}
-	return i.fillGset(buf)
+	r.Cmd = CMD_GSET
+	r.Data = buf[:GSET_SIZE]
+	return nil
+}
+
+func (i *Interface) fillEthtool() error {
+	res := &ethtoolResult{}
+	artifact := "ethtool/" + i.Name + ".json"
+	if i.env.Live() {
+		if err := res.query(i.Name); err != nil || res.Data == nil {
+			return err
+		}
+		if i.env.Recording() {
+			buf, _ := json.Marshal(res)
+			i.env.SaveArtifact(artifact, buf)
+		}
+	} else {
+		buf, err := i.env.Artifact(artifact)
+		if err != nil {
+			// Not recorded, nothing to fill in.
+			return nil
+		}
+		if err := json.Unmarshal(buf, res); err != nil {
+			return err
+		}
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if res.BigEndian {
+		order = binary.BigEndian
+	}
+	switch res.Cmd {
+	case CMD_GLINKSETTINGS:
+		return i.fillGlink(order, res.Data)
+	case CMD_GSET:
+		return i.fillGset(order, res.Data)
+	}
+	return fmt.Errorf("Unknown ethtool command %d", res.Cmd)
 }
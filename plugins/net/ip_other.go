@@ -2,6 +2,20 @@
 
 package net
 
-func (i *Interface) Fill() error {
+import (
+	"errors"
+	"net"
+
+	"github.com/rackn/gohai/plugins"
+)
+
+func interfaces(env *plugins.Env) ([]net.Interface, error) {
+	if env.Live() {
+		return net.Interfaces()
+	}
+	return nil, errors.New("Interfaces can only be read from sysfs on Linux")
+}
+
+func (i *Interface) Fill(env *plugins.Env) error {
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,147 @@
+package net
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rackn/gohai/internal/fixtures"
+)
+
+func TestFixtures(t *testing.T) {
+	for _, m := range fixtures.Machines(t) {
+		m := m
+		t.Run(m.Name, func(t *testing.T) {
+			info, err := Gather(m.Env())
+			fixtures.Compare(t, filepath.Join("testdata", m.Name+".json"), m, "Networking", info, err)
+		})
+	}
+}
+
+func modeNames(bits []ModeBit) []string {
+	res := []string{}
+	for _, b := range bits {
+		res = append(res, b.String())
+	}
+	return res
+}
+
+func TestFillGset(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		buf := make([]byte, GSET_SIZE)
+		order.PutUint32(buf[0:], CMD_GSET)
+		// Supported: 1000baseT/Full, Autoneg, FIBRE
+		buf[4] = 1<<5 | 1<<6
+		buf[5] = 1 << 2
+		// Advertised: 1000baseT/Full
+		buf[8] = 1 << 5
+		// 100000 does not fit in the low 16 bits of the speed.
+		order.PutUint16(buf[12:], uint16(100000&0xffff))
+		order.PutUint16(buf[28:], uint16(100000>>16))
+		buf[14] = 1
+		buf[18] = 1
+		// Peer advertised: 100baseT/Half
+		buf[32] = 1 << 2
+		i := &Interface{}
+		if err := i.fillGset(order, buf); err != nil {
+			t.Fatal(err)
+		}
+		if i.Speed != 100000 || !i.Duplex || !i.Autonegotiation {
+			t.Errorf("%v: got speed %d duplex %v autoneg %v", order, i.Speed, i.Duplex, i.Autonegotiation)
+		}
+		for _, tc := range []struct {
+			got, want []string
+		}{
+			{modeNames(i.Supported), []string{"1000 base T Full", "Autoneg", "FIBRE"}},
+			{modeNames(i.Advertised), []string{"1000 base T Full"}},
+			{modeNames(i.PeerAdvertised), []string{"100 base T Half"}},
+		} {
+			if !reflect.DeepEqual(tc.got, tc.want) {
+				t.Errorf("%v: got modes %v, want %v", order, tc.got, tc.want)
+			}
+		}
+	}
+}
+
+func TestFillGlink(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, words := range []int{1, 2, 3} {
+			b := words * 4
+			buf := make([]byte, GLINKSETTINGS_SIZE+3*b)
+			order.PutUint32(buf[0:], CMD_GLINKSETTINGS)
+			order.PutUint32(buf[4:], 25000)
+			buf[8] = 1
+			buf[11] = 0
+			buf[15] = byte(words)
+			s, a, p := 48, 48+b, 48+2*b
+			// Supported: 10000baseT/Full
+			buf[s+1] = 1 << 4
+			// Advertised: Autoneg
+			buf[a] = 1 << 6
+			// Peer advertised: 10baseT/Half
+			buf[p] = 1
+			if words > 1 {
+				// Supported: 25000baseSR/Full lives in the second word.
+				buf[s+4] = 1 << 1
+			}
+			i := &Interface{}
+			if err := i.fillGlink(order, buf); err != nil {
+				t.Fatal(err)
+			}
+			if i.Speed != 25000 || !i.Duplex || i.Autonegotiation {
+				t.Errorf("%v/%d: got speed %d duplex %v autoneg %v", order, words, i.Speed, i.Duplex, i.Autonegotiation)
+			}
+			supported := []string{"10000 base T Full"}
+			if words > 1 {
+				supported = append(supported, "25000 base SR Full")
+			}
+			for _, tc := range []struct {
+				got, want []string
+			}{
+				{modeNames(i.Supported), supported},
+				{modeNames(i.Advertised), []string{"Autoneg"}},
+				{modeNames(i.PeerAdvertised), []string{"10 base T Half"}},
+			} {
+				if !reflect.DeepEqual(tc.got, tc.want) {
+					t.Errorf("%v/%d: got modes %v, want %v", order, words, tc.got, tc.want)
+				}
+			}
+		}
+	}
+}
+
+func TestEthtoolShort(t *testing.T) {
+	// Settings replayed from a truncated or edited capture.
+	glink := make([]byte, GLINKSETTINGS_SIZE+3*4)
+	glink[15] = 2
+	for name, fill := range map[string]func() error{
+		"GSET":                    func() error { return (&Interface{}).fillGset(binary.LittleEndian, make([]byte, GSET_SIZE-1)) },
+		"GLINKSETTINGS":           func() error { return (&Interface{}).fillGlink(binary.LittleEndian, make([]byte, 16)) },
+		"GLINKSETTINGS link mode": func() error { return (&Interface{}).fillGlink(binary.LittleEndian, glink) },
+	} {
+		if err := fill(); err == nil {
+			t.Errorf("%s: short result was not an error", name)
+		}
+	}
+}
+
+func TestVLANConfig(t *testing.T) {
+	m := fixtures.Lookup(t, "dell-r630-xeon-e5")
+	info, err := Gather(m.Env())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, intf := range info.Interfaces {
+		switch intf.Name {
+		case "bond0.100":
+			if !intf.Sys.IsVlan || intf.Sys.VLAN.Id != 100 || intf.Sys.VLAN.Master != "bond0" {
+				t.Errorf("bond0.100: got vlan %v %+v", intf.Sys.IsVlan, intf.Sys.VLAN)
+			}
+		default:
+			if intf.Sys.IsVlan {
+				t.Errorf("%s: unexpectedly a vlan: %+v", intf.Name, intf.Sys.VLAN)
+			}
+		}
+	}
+}
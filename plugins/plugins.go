@@ -0,0 +1,119 @@
+// Package plugins holds the registry of collectors that gohai knows
+// how to run.  Each collector package registers itself when it is
+// imported, so adding a new collector is a matter of importing its
+// package.
+package plugins
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Info is the interface that all gathered information must satisfy.
+// Class returns the name that the information is reported under.
+type Info interface {
+	Class() string
+}
+
+// Collector describes a source of information that gohai can gather.
+type Collector struct {
+	// Name is the short name of the collector, usually the name of the
+	// package that provides it.
+	Name string
+	// Class is the class of the Info that Gather returns.
+	Class string
+	// OS is the list of GOOS values the collector supports.  An empty
+	// list means all of them.
+	OS []string
+	// Arch is the list of GOARCH values the collector supports.  An
+	// empty list means all of them.
+	Arch []string
+	// Sections lists the top-level fields of the Info that can be
+	// selected individually.
+	Sections []string
+	// Gather collects the information.
+	Gather func(env *Env) (Info, error)
+}
+
+// Supported returns whether the collector can run on the passed OS
+// and architecture.
+func (c Collector) Supported(goos, goarch string) bool {
+	return matches(c.OS, goos) && matches(c.Arch, goarch)
+}
+
+// Run calls Gather, turning a panic in the collector into an error so
+// that one broken collector cannot take the rest down with it.
+func (c Collector) Run(env *Env) (info Info, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			info = nil
+			err = &StepError{Step: "panic", Err: fmt.Errorf("%v", r)}
+		}
+	}()
+	return c.Gather(env)
+}
+
+func matches(list []string, val string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == val {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	collectorMux sync.Mutex
+	collectors   = map[string]Collector{}
+)
+
+// Register makes a collector available.  It panics if the collector
+// has no Class or Gather func, or if a collector for the same Class
+// has already been registered.
+func Register(c Collector) {
+	collectorMux.Lock()
+	defer collectorMux.Unlock()
+	if c.Class == "" {
+		panic(fmt.Sprintf("plugins: collector %q has no class", c.Name))
+	}
+	if c.Gather == nil {
+		panic(fmt.Sprintf("plugins: collector %q has no Gather func", c.Name))
+	}
+	if _, ok := collectors[c.Class]; ok {
+		panic(fmt.Sprintf("plugins: collector for class %s already registered", c.Class))
+	}
+	if c.Name == "" {
+		c.Name = c.Class
+	}
+	collectors[c.Class] = c
+}
+
+// Collectors returns all registered collectors sorted by Class.
+func Collectors() []Collector {
+	collectorMux.Lock()
+	defer collectorMux.Unlock()
+	res := make([]Collector, 0, len(collectors))
+	for _, c := range collectors {
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Class < res[j].Class })
+	return res
+}
+
+// Available returns the registered collectors that support the OS
+// and architecture gohai is running on, sorted by Class.
+func Available() []Collector {
+	return (*Env)(nil).Collectors()
+}
+
+// Lookup returns the collector registered for class.
+func Lookup(class string) (Collector, bool) {
+	collectorMux.Lock()
+	defer collectorMux.Unlock()
+	c, ok := collectors[class]
+	return c, ok
+}
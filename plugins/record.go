@@ -0,0 +1,111 @@
+package plugins
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// ArtifactDir is the directory under the Root that artifacts are
+// kept in.  Artifacts hold everything that does not come from a file,
+// like the output of external commands and ioctl results.
+const ArtifactDir = ".gohai"
+
+// Recorder is told about everything that is read through an Env.
+// Paths are relative to the Root of the Env, with any symlinks in
+// them resolved.  Recorders must be safe for concurrent use.
+type Recorder interface {
+	// File is called with the contents of every file that is read.
+	File(path string, content []byte)
+	// Dir is called for every directory that is read or stat'ed.
+	Dir(path string)
+	// Link is called for every symlink that is followed or read.
+	Link(path, target string)
+	// Device is called for every device node that is stat'ed.
+	Device(path string, mode os.FileMode)
+	// Artifact is called with every artifact that is saved.
+	Artifact(name string, content []byte)
+}
+
+type deviceInfo struct {
+	name string
+	mode os.FileMode
+}
+
+func (d deviceInfo) Name() string       { return d.name }
+func (d deviceInfo) Size() int64        { return 0 }
+func (d deviceInfo) Mode() os.FileMode  { return d.mode }
+func (d deviceInfo) ModTime() time.Time { return time.Time{} }
+func (d deviceInfo) IsDir() bool        { return false }
+func (d deviceInfo) Sys() interface{}   { return nil }
+
+// DevicesArtifact is the artifact that device nodes are recorded in,
+// as a map of path to os.FileMode.
+const DevicesArtifact = "devices.json"
+
+func (e *Env) devices() map[string]os.FileMode {
+	res := map[string]os.FileMode{}
+	if buf, err := e.Artifact(DevicesArtifact); err == nil {
+		json.Unmarshal(buf, &res)
+	}
+	return res
+}
+
+// Artifact returns the contents of the named artifact.  Artifacts
+// only exist under a Root that is not the running system.
+func (e *Env) Artifact(name string) ([]byte, error) {
+	if e.Live() {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.ReadFile(filepath.Join(e.root(), ArtifactDir, filepath.FromSlash(path.Clean("/"+name))))
+}
+
+// SaveArtifact hands the named artifact to the Recorder, if there is
+// one.
+func (e *Env) SaveArtifact(name string, content []byte) {
+	if e.Recording() {
+		e.Recorder.Artifact(path.Clean(name), content)
+	}
+}
+
+// Platform describes the system that information is gathered from.
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+// PlatformArtifact is the artifact that the Platform of a captured
+// system is recorded in.
+const PlatformArtifact = "platform.json"
+
+// Platform returns the Platform of the system the Env refers to.  If
+// the Root does not say what it was captured from, the Platform of
+// the running system is returned.
+func (e *Env) Platform() Platform {
+	res := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if buf, err := e.Artifact(PlatformArtifact); err == nil {
+		json.Unmarshal(buf, &res)
+	}
+	return res
+}
+
+// Collectors returns the registered collectors that support the
+// Platform of the Env and have something selected, sorted by Class.
+func (e *Env) Collectors() []Collector {
+	p := e.Platform()
+	res := []Collector{}
+	for _, c := range Collectors() {
+		if !c.Supported(p.OS, p.Arch) {
+			continue
+		}
+		if e != nil && !e.Selection.Class(c.Class) {
+			continue
+		}
+		res = append(res, c)
+	}
+	return res
+}
@@ -0,0 +1,68 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Result is what a collector gathered when it was run by RunAll.
+type Result struct {
+	Collector Collector
+	Info      Info
+	Err       error
+}
+
+// RunAll runs the collectors in env at the same time, and returns
+// what each of them gathered in the same order.  Each collector is
+// given timeout to finish (0 means as long as it needs), and they
+// all have to finish before ctx is done.
+//
+// A collector that does not finish in time is abandoned, and its
+// Result has a StepError for the "timeout" step.  The context of the
+// Env it gathers with is cancelled, which kills any command it is
+// waiting on.
+func RunAll(ctx context.Context, env *Env, collectors []Collector, timeout time.Duration) []Result {
+	res := make([]Result, len(collectors))
+	done := make(chan int)
+	for i := range collectors {
+		go func(i int) {
+			res[i] = run(ctx, env, collectors[i], timeout)
+			done <- i
+		}(i)
+	}
+	for range collectors {
+		<-done
+	}
+	return res
+}
+
+func run(ctx context.Context, env *Env, c Collector, timeout time.Duration) Result {
+	cctx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		cctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+	if cctx.Err() == nil {
+		finished := make(chan Result, 1)
+		go func() {
+			info, err := c.Run(env.WithContext(cctx))
+			finished <- Result{Collector: c, Info: info, Err: err}
+		}()
+		select {
+		case res := <-finished:
+			return res
+		case <-cctx.Done():
+		}
+	}
+	var err error
+	switch ctx.Err() {
+	case nil:
+		err = fmt.Errorf("%s did not finish within %v", c.Name, timeout)
+	case context.DeadlineExceeded:
+		err = fmt.Errorf("%s did not finish before the overall timeout", c.Name)
+	default:
+		err = fmt.Errorf("%s was cancelled", c.Name)
+	}
+	return Result{Collector: c, Err: &StepError{Step: "timeout", Err: err}}
+}
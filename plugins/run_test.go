@@ -0,0 +1,107 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testInfo string
+
+func (t testInfo) Class() string {
+	return string(t)
+}
+
+func collector(class string, gather func(env *Env) (Info, error)) Collector {
+	return Collector{Name: strings.ToLower(class), Class: class, Gather: gather}
+}
+
+func TestRunAll(t *testing.T) {
+	// Each collector waits for the other to start, so they only
+	// finish if they run at the same time.
+	started := make(chan struct{}, 2)
+	concurrent := func(class string) Collector {
+		return collector(class, func(env *Env) (Info, error) {
+			started <- struct{}{}
+			for len(started) < 2 {
+				select {
+				case <-env.Context().Done():
+					return nil, env.Context().Err()
+				case <-time.After(time.Millisecond):
+				}
+			}
+			return testInfo(class), nil
+		})
+	}
+	stalled := collector("Stalled", func(env *Env) (Info, error) {
+		select {}
+	})
+	broken := collector("Broken", func(env *Env) (Info, error) {
+		return testInfo("Broken"), &StepError{Step: "read", Err: errors.New("no such file")}
+	})
+	panics := collector("Panics", func(env *Env) (Info, error) {
+		panic("oops")
+	})
+	res := RunAll(context.Background(), nil,
+		[]Collector{concurrent("A"), stalled, broken, concurrent("B"), panics}, time.Second)
+	for i, want := range []string{"A:<nil>", "Stalled:timeout: stalled did not finish within 1s",
+		"Broken:read: no such file", "B:<nil>", "Panics:panic: oops"} {
+		got := res[i].Collector.Class + ":"
+		if res[i].Err != nil {
+			got += res[i].Err.Error()
+		} else {
+			got += "<nil>"
+		}
+		if got != want {
+			t.Errorf("Result %d is %s, want %s", i, got, want)
+		}
+	}
+	if res[0].Info != testInfo("A") || res[2].Info != testInfo("Broken") || res[1].Info != nil {
+		t.Errorf("Unexpected infos in %v", res)
+	}
+}
+
+func TestRunAllOverallTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	slow := collector("Slow", func(env *Env) (Info, error) {
+		<-env.Context().Done()
+		return nil, env.Context().Err()
+	})
+	start := time.Now()
+	res := RunAll(ctx, nil, []Collector{slow}, time.Hour)
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("RunAll took %v", time.Since(start))
+	}
+	if res[0].Err == nil || res[0].Err.Error() != "timeout: slow did not finish before the overall timeout" {
+		t.Errorf("Unexpected error %v", res[0].Err)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep command")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	env := (&Env{}).WithContext(ctx)
+	start := time.Now()
+	if _, err := env.Run("sleep", "10"); err != context.DeadlineExceeded {
+		t.Errorf("Run got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("sleep was not killed, Run took %v", time.Since(start))
+	}
+	// Runners that cannot be stopped are not started once the
+	// context is done.
+	env.Runner = CannedRunner{"lshw -json": "{}"}
+	if _, err := env.Run("lshw", "-json"); err != context.DeadlineExceeded {
+		t.Errorf("Run got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if (*Env)(nil).Context() == nil || (&Env{}).Context() == nil {
+		t.Errorf("Env without a context has a nil Context")
+	}
+}
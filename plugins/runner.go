@@ -0,0 +1,146 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoCommand is returned by a Runner when the command is not
+// installed, or when its output was not recorded.
+var ErrNoCommand = errors.New("command not available")
+
+// Runner runs the external commands that collectors need, like lshw
+// and udevadm.
+type Runner interface {
+	// Run runs a command and returns its standard output.
+	Run(name string, args ...string) ([]byte, error)
+}
+
+// ContextRunner is a Runner that can stop a command when a context is
+// done.
+type ContextRunner interface {
+	Runner
+	RunContext(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// runContext runs a command with r, stopping it when ctx is done if r
+// knows how to.
+func runContext(ctx context.Context, r Runner, name string, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cr, ok := r.(ContextRunner); ok {
+		return cr.RunContext(ctx, name, args...)
+	}
+	return r.Run(name, args...)
+}
+
+// CommandKey returns the name that the output of a command is
+// recorded under.
+func CommandKey(name string, args ...string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, strings.Join(append([]string{name}, args...), "_"))
+}
+
+// ExecRunner runs commands on the running system.
+type ExecRunner struct{}
+
+func (r ExecRunner) Run(name string, args ...string) ([]byte, error) {
+	return r.RunContext(context.Background(), name, args...)
+}
+
+// RunContext runs a command, killing it if ctx is done before it
+// finishes.
+func (ExecRunner) RunContext(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, ErrNoCommand
+	}
+	buf, err := exec.CommandContext(ctx, name, args...).Output()
+	if ctx.Err() != nil {
+		return buf, ctx.Err()
+	}
+	return buf, err
+}
+
+// ReplayRunner returns the output of commands recorded in Dir by a
+// RecordingRunner or by a capture.
+type ReplayRunner struct {
+	Dir string
+}
+
+func (r ReplayRunner) Run(name string, args ...string) ([]byte, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(r.Dir, CommandKey(name, args...)))
+	if err != nil {
+		return nil, ErrNoCommand
+	}
+	return buf, nil
+}
+
+// RecordingRunner runs commands with Runner, and records the output
+// of the ones that succeed in Dir for a ReplayRunner.
+type RecordingRunner struct {
+	Runner Runner
+	Dir    string
+}
+
+func (r RecordingRunner) Run(name string, args ...string) ([]byte, error) {
+	return r.RunContext(context.Background(), name, args...)
+}
+
+// RunContext runs a command with Runner, stopping it when ctx is done
+// if Runner knows how to.
+func (r RecordingRunner) RunContext(ctx context.Context, name string, args ...string) ([]byte, error) {
+	buf, err := runContext(ctx, r.Runner, name, args...)
+	if err != nil {
+		return buf, err
+	}
+	if err := os.MkdirAll(r.Dir, 0755); err != nil {
+		return buf, err
+	}
+	return buf, ioutil.WriteFile(filepath.Join(r.Dir, CommandKey(name, args...)), buf, 0644)
+}
+
+// CannedRunner returns canned output for commands, keyed by the
+// command line with its arguments separated by single spaces.
+type CannedRunner map[string]string
+
+func (c CannedRunner) Run(name string, args ...string) ([]byte, error) {
+	out, ok := c[strings.Join(append([]string{name}, args...), " ")]
+	if !ok {
+		return nil, ErrNoCommand
+	}
+	return []byte(out), nil
+}
+
+// commandDir is where commands are recorded in the ArtifactDir.
+const commandDir = "commands"
+
+// Run runs a command with the Runner of the Env.  Without one, the
+// command is run on the running system, or replayed from the Root if
+// it is not the running system.  Commands are stopped when the
+// context of the Env is done, if the Runner knows how to.  The output
+// of successful commands is saved as an artifact.
+func (e *Env) Run(name string, args ...string) ([]byte, error) {
+	var runner Runner = ExecRunner{}
+	switch {
+	case e != nil && e.Runner != nil:
+		runner = e.Runner
+	case !e.Live():
+		runner = ReplayRunner{Dir: filepath.Join(e.root(), ArtifactDir, commandDir)}
+	}
+	buf, err := runContext(e.Context(), runner, name, args...)
+	if err == nil {
+		e.SaveArtifact(filepath.ToSlash(filepath.Join(commandDir, CommandKey(name, args...))), buf)
+	}
+	return buf, err
+}
@@ -0,0 +1,54 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommandKey(t *testing.T) {
+	for want, cmd := range map[string][]string{
+		"lshw_-quiet_-c_storage_-json":               {"lshw", "-quiet", "-c", "storage", "-json"},
+		"udevadm_info_-q_all_-p__sys_class_net_eth0": {"udevadm", "info", "-q", "all", "-p", "/sys/class/net/eth0"},
+		"dmidecode_-t_2":                             {"dmidecode", "-t", "2"},
+	} {
+		if got := CommandKey(cmd[0], cmd[1:]...); got != want {
+			t.Errorf("CommandKey(%v) = %s, want %s", cmd, got, want)
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohai-runner-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	canned := CannedRunner{"lshw -json": "{}\n"}
+	rec := RecordingRunner{Runner: canned, Dir: filepath.Join(dir, "commands")}
+	if out, err := rec.Run("lshw", "-json"); err != nil || string(out) != "{}\n" {
+		t.Fatalf("Recording got %q, %v", out, err)
+	}
+	if _, err := rec.Run("udevadm", "info"); err != ErrNoCommand {
+		t.Errorf("Recording a missing command got %v, want %v", err, ErrNoCommand)
+	}
+	replay := ReplayRunner{Dir: rec.Dir}
+	if out, err := replay.Run("lshw", "-json"); err != nil || string(out) != "{}\n" {
+		t.Errorf("Replay got %q, %v", out, err)
+	}
+	if _, err := replay.Run("udevadm", "info"); err != ErrNoCommand {
+		t.Errorf("Replaying a missing command got %v, want %v", err, ErrNoCommand)
+	}
+	// An Env that is not live replays from its Root.
+	if err := os.MkdirAll(filepath.Join(dir, ArtifactDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(rec.Dir, filepath.Join(dir, ArtifactDir, commandDir)); err != nil {
+		t.Fatal(err)
+	}
+	env := &Env{Root: dir}
+	if out, err := env.Run("lshw", "-json"); err != nil || string(out) != "{}\n" {
+		t.Errorf("Env replay got %q, %v", out, err)
+	}
+}
@@ -5,15 +5,31 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
+
+	"github.com/rackn/gohai/plugins"
 )
 
+func init() {
+	plugins.Register(plugins.Collector{
+		Name:     "storage",
+		Class:    "Storage",
+		OS:       []string{"linux"},
+		Sections: []string{"Volumes", "Disks", "Controllers"},
+		Gather: func(env *plugins.Env) (plugins.Info, error) {
+			res, err := Gather(env)
+			if res == nil {
+				return nil, err
+			}
+			return res, err
+		},
+	})
+}
+
 // At some point, also need to add mode block device oriented information here
 
 type Volume struct {
@@ -41,6 +57,7 @@ type LogicalDisk struct {
 	Removable  bool   // Removable
 	ReadOnly   bool   // ReadOnly
 	Rotational bool   // Rotational
+	NUMANode   int64  // NUMANode - NUMA node of the device the disk is on, or -1 if not known
 }
 
 type Info struct {
@@ -53,16 +70,16 @@ func (i *Info) Class() string {
 	return "Storage"
 }
 
-func getStringFromFile(file, def string) string {
-	data, err := ioutil.ReadFile(file)
+func getStringFromFile(env *plugins.Env, file, def string) string {
+	data, err := env.ReadFile(file)
 	if err != nil {
 		return def
 	}
 	return strings.TrimSpace(string(data))
 }
 
-func getInt64FromFile(file string, def int64) int64 {
-	s := getStringFromFile(file, "BAD")
+func getInt64FromFile(env *plugins.Env, file string, def int64) int64 {
+	s := getStringFromFile(env, file, "BAD")
 	if s == "BAD" {
 		return def
 	}
@@ -74,29 +91,48 @@ func getInt64FromFile(file string, def int64) int64 {
 }
 
 // assumes 0 is false and other is true
-func getBoolFromFile(file string, def bool) bool {
+func getBoolFromFile(env *plugins.Env, file string, def bool) bool {
 	idef := int64(0)
 	if def {
 		idef = 1
 	}
-	if ii := getInt64FromFile(file, idef); ii == 0 {
+	if ii := getInt64FromFile(env, file, idef); ii == 0 {
 		return false
 	}
 	return true
 }
 
-func Gather() (*Info, error) {
+func Gather(env *plugins.Env) (*Info, error) {
 	res := &Info{
 		Volumes:     []Volume{},
 		Disks:       []LogicalDisk{},
 		Controllers: []interface{}{},
 	}
+	errs := plugins.Errors{}
+	if env.Wants(res.Class(), "Volumes") {
+		errs.Fail("mounts", res.fillVolumes(env))
+	}
+	if env.Wants(res.Class(), "Disks") {
+		errs.Fail("disks", res.fillDisks(env))
+	}
+	if env.Wants(res.Class(), "Controllers") {
+		errs.Fail("controllers", res.fillControllers(env))
+	}
+	return res, errs.Err()
+}
 
-	mounts, err := os.Open("/proc/self/mounts")
+func (i *Info) fillVolumes(env *plugins.Env) error {
+	mounts, err := env.Open("/proc/self/mounts")
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer mounts.Close()
+	// Usage can only be had from the filesystems mounted on the
+	// running system, so it is recorded as an artifact for replays.
+	usage := map[string]json.RawMessage{}
+	if buf, err := env.Artifact("statfs.json"); err == nil {
+		json.Unmarshal(buf, &usage)
+	}
 	mountLines := bufio.NewScanner(mounts)
 	for mountLines.Scan() {
 		line := mountLines.Text()
@@ -110,30 +146,42 @@ func Gather() (*Info, error) {
 			Filesystem:    fields[2],
 			Options:       fields[3],
 		}
-		stat, err := os.Stat(vol.BackingDevice)
-		if err == nil {
-			vol.Virtual = !(stat.Mode()&os.ModeDevice > 0)
+		if strings.HasPrefix(vol.BackingDevice, "/") {
+			stat, err := env.Stat(vol.BackingDevice)
+			if err == nil {
+				vol.Virtual = !(stat.Mode()&os.ModeDevice > 0)
+			}
 		}
 		fsStat := &syscall.Statfs_t{}
-		if err := syscall.Statfs(vol.Name, fsStat); err == nil {
+		if !env.Live() {
+			json.Unmarshal(usage[vol.Name], &vol.Blocks)
+		} else if err := syscall.Statfs(vol.Name, fsStat); err == nil {
 			vol.Blocks.Size = int64(fsStat.Bsize)
 			vol.Blocks.Total = fsStat.Blocks
 			vol.Blocks.Free = fsStat.Bfree
 			vol.Blocks.Avail = fsStat.Bavail
+			usage[vol.Name], _ = json.Marshal(vol.Blocks)
 		}
-		res.Volumes = append(res.Volumes, vol)
+		i.Volumes = append(i.Volumes, vol)
+	}
+	if env.Live() && env.Recording() {
+		buf, _ := json.Marshal(usage)
+		env.SaveArtifact("statfs.json", buf)
 	}
+	return mountLines.Err()
+}
 
-	files, err := ioutil.ReadDir("/sys/block")
+func (i *Info) fillDisks(env *plugins.Env) error {
+	files, err := env.ReadDir("/sys/block")
 	if err == nil {
 		disks := []LogicalDisk{}
 		for _, fi := range files {
 			file := fi.Name()
-			_, err := os.Stat(fmt.Sprintf("/sys/block/%s/device", file))
+			_, err := env.Stat(fmt.Sprintf("/sys/block/%s/device", file))
 			if os.IsNotExist(err) {
 				continue
 			}
-			dtype := getInt64FromFile(fmt.Sprintf("/sys/block/%s/device/type", file), 0)
+			dtype := getInt64FromFile(env, fmt.Sprintf("/sys/block/%s/device/type", file), 0)
 			switch dtype {
 			case 0, 12, 13, 7:
 				// These are good.
@@ -143,16 +191,17 @@ func Gather() (*Info, error) {
 
 			disk := LogicalDisk{}
 			disk.Name = fmt.Sprintf("/dev/%s", file)
-			disk.Removable = getBoolFromFile(fmt.Sprintf("/sys/block/%s/removable", file), false)
-			disk.ReadOnly = getBoolFromFile(fmt.Sprintf("/sys/block/%s/ro", file), false)
-			disk.Rotational = getBoolFromFile(fmt.Sprintf("/sys/block/%s/queue/rotational", file), false)
-			disk.Dev = getStringFromFile(fmt.Sprintf("/sys/block/%s/dev", file), "0:0")
-			ii := getInt64FromFile(fmt.Sprintf("/sys/block/%s/size", file), 0)
+			disk.Removable = getBoolFromFile(env, fmt.Sprintf("/sys/block/%s/removable", file), false)
+			disk.ReadOnly = getBoolFromFile(env, fmt.Sprintf("/sys/block/%s/ro", file), false)
+			disk.Rotational = getBoolFromFile(env, fmt.Sprintf("/sys/block/%s/queue/rotational", file), false)
+			disk.Dev = getStringFromFile(env, fmt.Sprintf("/sys/block/%s/dev", file), "0:0")
+			ii := getInt64FromFile(env, fmt.Sprintf("/sys/block/%s/size", file), 0)
 			disk.Size = ii * 512
-			disk.Product = getStringFromFile(fmt.Sprintf("/sys/block/%s/device/model", file), "UNKNOWN")
-			disk.Vendor = getStringFromFile(fmt.Sprintf("/sys/block/%s/device/vendor", file), "UNKNOWN")
+			disk.Product = getStringFromFile(env, fmt.Sprintf("/sys/block/%s/device/model", file), "UNKNOWN")
+			disk.Vendor = getStringFromFile(env, fmt.Sprintf("/sys/block/%s/device/vendor", file), "UNKNOWN")
+			disk.NUMANode = env.NUMANode(fmt.Sprintf("/sys/block/%s", file))
 
-			dir, err := os.Readlink(fmt.Sprintf("/sys/block/%s", file))
+			dir, err := env.Readlink(fmt.Sprintf("/sys/block/%s", file))
 			if err != nil {
 				dir = "../devices/pci/UNKNOWN"
 			}
@@ -167,36 +216,46 @@ func Gather() (*Info, error) {
 				disk.BusInfo = answer
 			}
 
-			data, err := ioutil.ReadFile(fmt.Sprintf("/sys/block/%s/device/vpd_pg80", file))
-			if err == nil {
-				len := binary.BigEndian.Uint16(data[2:])
-				s := string(data[4:(len - 1)])
-				disk.Serial = s
-			} else {
-				disk.Serial = "UNKNOWN"
+			// The unit serial number VPD page is a 4 byte header with
+			// the length of the serial number, and then the serial
+			// number padded with spaces.
+			disk.Serial = "UNKNOWN"
+			data, err := env.ReadFile(fmt.Sprintf("/sys/block/%s/device/vpd_pg80", file))
+			if err == nil && len(data) >= 4 {
+				end := 4 + int(binary.BigEndian.Uint16(data[2:]))
+				if end > len(data) {
+					end = len(data)
+				}
+				if s := strings.TrimSpace(string(data[4:end])); s != "" {
+					disk.Serial = s
+				}
 			}
 			disks = append(disks, disk)
 		}
-		res.Disks = disks
+		i.Disks = disks
 	}
+	return err
+}
 
-	// We have lshw - use it.
-	if _, err := exec.Command("lshw", "--help").CombinedOutput(); err == nil {
-		objs, err := getLSHWPiece("storage")
-		if err != nil {
-			return nil, err
-		}
-		res.Controllers = objs
+func (i *Info) fillControllers(env *plugins.Env) error {
+	objs, err := getLSHWPiece(env, "storage")
+	if err == plugins.ErrNoCommand {
+		// No lshw, no controllers.
+		return nil
+	}
+	if err != nil {
+		return err
 	}
-	return res, nil
+	i.Controllers = objs
+	return nil
 }
 
 var missingComma = regexp.MustCompile(`\n[ \t]*}[ \t]*{[ \t]*\n`)
 var trailingComma = regexp.MustCompile(`},$`)
 
-func getLSHWPiece(class string) ([]interface{}, error) {
+func getLSHWPiece(env *plugins.Env, class string) ([]interface{}, error) {
 
-	out, err := exec.Command("lshw", "-quiet", "-c", class, "-json").CombinedOutput()
+	out, err := env.Run("lshw", "-quiet", "-c", class, "-json")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/rackn/gohai/internal/fixtures"
+	"github.com/rackn/gohai/plugins"
+)
+
+func TestFixtures(t *testing.T) {
+	for _, m := range fixtures.Machines(t) {
+		m := m
+		t.Run(m.Name, func(t *testing.T) {
+			info, err := Gather(m.Env())
+			fixtures.Compare(t, filepath.Join("testdata", m.Name+".json"), m, "Storage", info, err)
+		})
+	}
+}
+
+func TestGetLSHWPiece(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		out  string
+		ids  []string
+	}{
+		{"array", "[\n  {\n    \"id\" : \"sata\"\n  },\n  {\n    \"id\" : \"nvme\"\n  }\n]\n", []string{"sata", "nvme"}},
+		{"bare object", "{\n  \"id\" : \"nvme\"\n}\n", []string{"nvme"}},
+		{"missing comma", "{\n  \"id\" : \"raid\"\n}  {\n  \"id\" : \"sata\"\n}\n", []string{"raid", "sata"}},
+		{"missing commas", "{\n  \"id\" : \"a\"\n}{\n  \"id\" : \"b\"\n  }\t{\n  \"id\" : \"c\"\n}", []string{"a", "b", "c"}},
+		{"trailing comma", "{\n  \"id\" : \"scsi\"\n},\n{\n  \"id\" : \"fibre\"\n},\n", []string{"scsi", "fibre"}},
+		{"empty", "", []string{}},
+	} {
+		env := &plugins.Env{Runner: plugins.CannedRunner{"lshw -quiet -c storage -json": tc.out}}
+		objs, err := getLSHWPiece(env, "storage")
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(objs) != len(tc.ids) {
+			t.Errorf("%s: got %d objects, want %d", tc.name, len(objs), len(tc.ids))
+			continue
+		}
+		for i, obj := range objs {
+			if id := obj.(map[string]interface{})["id"]; id != tc.ids[i] {
+				t.Errorf("%s: object %d has id %v, want %s", tc.name, i, id, tc.ids[i])
+			}
+		}
+	}
+	env := &plugins.Env{Runner: plugins.CannedRunner{}}
+	if _, err := getLSHWPiece(env, "storage"); err != plugins.ErrNoCommand {
+		t.Errorf("Without lshw got %v, want %v", err, plugins.ErrNoCommand)
+	}
+}
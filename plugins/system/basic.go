@@ -1,10 +1,32 @@
 package system
 
 import (
-	"runtime"
+	"bufio"
+	"fmt"
 	"strconv"
+	"strings"
+
+	"github.com/rackn/gohai/plugins"
 )
 
+func init() {
+	plugins.Register(plugins.Collector{
+		Name:  "system",
+		Class: "System",
+		Sections: []string{
+			"OS", "Arch", "Kernel", "Memory",
+			"ProcessorCount", "Processors", "Topology", "NUMA",
+		},
+		Gather: func(env *plugins.Env) (plugins.Info, error) {
+			res, err := Gather(env)
+			if res == nil {
+				return nil, err
+			}
+			return res, err
+		},
+	})
+}
+
 type Processor struct {
 	ID             int64
 	Vendor         string
@@ -12,11 +34,13 @@ type Processor struct {
 	ModelCode      int64
 	Model          string
 	Stepping       int64
+	Variant        int64
+	MIDR           string
 	Microcode      int64
 	Speed          string
 	CacheSize      string
 	PhysID         int64
-	Sibligs        int64
+	Siblings       int64
 	CoreID         int64
 	Cores          int64
 	FPU            bool
@@ -28,6 +52,9 @@ type Processor struct {
 		Physical int64
 		Virtual  int64
 	}
+	// Other has the lines of /proc/cpuinfo for the processor that
+	// are not parsed into the fields above, by key.
+	Other map[string]string
 }
 
 type Info struct {
@@ -41,28 +68,107 @@ type Info struct {
 	}
 	ProcessorCount int
 	Processors     []Processor
+	Topology       *Topology
+	NUMA           []NUMANode
 }
 
 func (i *Info) Class() string {
 	return "System"
 }
 
-func mPI(s string, size int) int64 {
-	res, err := strconv.ParseInt(s, 0, size)
-	if err != nil {
-		panic("Failed to parse int")
-	}
-	return res
-}
-
-func Gather() (*Info, error) {
+func Gather(env *plugins.Env) (*Info, error) {
+	platform := env.Platform()
 	res := &Info{
-		OS:   runtime.GOOS,
-		Arch: runtime.GOARCH,
+		OS:   platform.OS,
+		Arch: platform.Arch,
 	}
 	switch res.OS {
 	case "linux":
-		return res, fillLinux(res)
+		return res, fillLinux(env, res)
 	}
 	return res, nil
 }
+
+func fillLinux(env *plugins.Env, i *Info) error {
+	errs := plugins.Errors{}
+	if env.Wants(i.Class(), "Kernel") {
+		errs.Fail("version", i.fillVersion(env))
+	}
+	if env.Wants(i.Class(), "Memory") {
+		errs.Fail("meminfo", i.fillMemInfo(env))
+	}
+	wantsTopology := env.Wants(i.Class(), "Topology")
+	if env.Wants(i.Class(), "Processors") || env.Wants(i.Class(), "ProcessorCount") || wantsTopology {
+		errs.Merge(i.fillCPUInfo(env))
+	}
+	if wantsTopology {
+		errs.Warn("topology", i.fillTopology(env))
+	}
+	if env.Wants(i.Class(), "NUMA") {
+		errs.Merge(i.fillNUMA(env))
+	}
+	return errs.Err()
+}
+
+// fillCPUInfo picks the /proc/cpuinfo parser that understands the
+// format for the architecture.
+func (i *Info) fillCPUInfo(env *plugins.Env) error {
+	switch i.Arch {
+	case "ppc64le":
+		return i.fillPowerCPUInfo(env)
+	case "arm64":
+		return i.fillARMCPUInfo(env)
+	default:
+		return i.fillGenericCPUInfo(env)
+	}
+}
+
+func (i *Info) fillVersion(env *plugins.Env) error {
+	vbytes, err := env.ReadFile("/proc/version")
+	if err != nil {
+		return err
+	}
+	// Linux version 5.4.0-77-generic (buildd@...) ...
+	fields := strings.Fields(string(vbytes))
+	if len(fields) < 3 {
+		return fmt.Errorf("No kernel release in %q", strings.TrimSpace(string(vbytes)))
+	}
+	i.Kernel = fields[2]
+	return nil
+}
+
+func (i *Info) fillMemInfo(env *plugins.Env) error {
+	memInfo, err := env.Open("/proc/meminfo")
+	if err != nil {
+		return err
+	}
+	defer memInfo.Close()
+	lines := bufio.NewScanner(memInfo)
+	for lines.Scan() {
+		frags := strings.SplitN(lines.Text(), ":", 2)
+		var dest *int64
+		switch frags[0] {
+		case "MemTotal":
+			dest = &i.Memory.Total
+		case "MemFree":
+			dest = &i.Memory.Free
+		case "MemAvailable":
+			dest = &i.Memory.Available
+		default:
+			continue
+		}
+		if len(frags) != 2 {
+			return fmt.Errorf("%s has no size", frags[0])
+		}
+		szPart := strings.Fields(frags[1])
+		if len(szPart) == 0 {
+			return fmt.Errorf("%s has no size", frags[0])
+		}
+		sz, err := strconv.ParseInt(szPart[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		*dest = sz << 10
+	}
+	return lines.Err()
+}
@@ -0,0 +1,185 @@
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rackn/gohai/plugins"
+)
+
+// cpuinfoLine is a "key : value" line of /proc/cpuinfo.
+type cpuinfoLine struct {
+	num        int
+	key, value string
+}
+
+// cpuinfo is /proc/cpuinfo, split into the blocks of lines for each
+// processor and the lines of the blocks that are not for one, which
+// some architectures have for all of them.
+type cpuinfo struct {
+	procs  [][]cpuinfoLine
+	common []cpuinfoLine
+	errs   plugins.Errors
+}
+
+func readCPUInfo(env *plugins.Env) (*cpuinfo, error) {
+	f, err := env.Open("/proc/cpuinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res := &cpuinfo{procs: [][]cpuinfoLine{}}
+	block := []cpuinfoLine{}
+	endBlock := func() {
+		for _, l := range block {
+			if l.key == "processor" {
+				res.procs = append(res.procs, block)
+				block = []cpuinfoLine{}
+				return
+			}
+		}
+		res.common = append(res.common, block...)
+		block = []cpuinfoLine{}
+	}
+	lines := bufio.NewScanner(f)
+	for num := 1; lines.Scan(); num++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" {
+			endBlock()
+			continue
+		}
+		frags := strings.SplitN(line, ":", 2)
+		if len(frags) != 2 {
+			res.errs.Warn("cpuinfo", fmt.Errorf("Line %d is not key: value", num))
+			continue
+		}
+		block = append(block, cpuinfoLine{
+			num:   num,
+			key:   strings.TrimSpace(frags[0]),
+			value: strings.TrimSpace(frags[1]),
+		})
+	}
+	endBlock()
+	return res, lines.Err()
+}
+
+func (c *cpuinfo) warn(l cpuinfoLine, format string, args ...interface{}) {
+	c.errs.Warn("cpuinfo", fmt.Errorf("Line %d: "+format, append([]interface{}{l.num}, args...)...))
+}
+
+// int parses the value of l, as a number in any base Go understands,
+// into dest, and reports whether it could.  Values too large for an
+// int64, like some microcode revisions, keep their bits.  Anything
+// else is warned about and left alone, so that the callers can keep
+// the line in Other.
+func (c *cpuinfo) int(l cpuinfoLine, dest *int64) bool {
+	if res, err := strconv.ParseInt(l.value, 0, 64); err == nil {
+		*dest = res
+		return true
+	}
+	if res, err := strconv.ParseUint(l.value, 0, 64); err == nil {
+		*dest = int64(res)
+		return true
+	}
+	c.warn(l, "%s is %q, not a number", l.key, l.value)
+	return false
+}
+
+// parse makes a Processor of each block of lines for one.  known
+// fills in the fields of the Processor from the lines the
+// architecture's parser understands, and the rest, including ones with
+// values it cannot parse, are kept in Other along with the common
+// lines.  done, if not nil, finishes off each Processor.
+func (c *cpuinfo) parse(known func(p *Processor, l cpuinfoLine) bool, done func(p *Processor)) []Processor {
+	res := []Processor{}
+	for _, block := range c.procs {
+		p := Processor{Other: map[string]string{}}
+		for _, l := range append(block, c.common...) {
+			switch {
+			case l.key == "processor" && c.int(l, &p.ID):
+			case known(&p, l):
+			default:
+				if _, ok := p.Other[l.key]; !ok {
+					p.Other[l.key] = l.value
+				}
+			}
+		}
+		if done != nil {
+			done(&p)
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+// fill parses the processors of c, and returns the warnings about them
+// along with err.
+func (i *Info) fill(c *cpuinfo, err error, known func(p *Processor, l cpuinfoLine) bool, done func(p *Processor)) error {
+	if c == nil {
+		return &plugins.StepError{Step: "cpuinfo", Err: err}
+	}
+	i.Processors = c.parse(known, done)
+	i.ProcessorCount = len(i.Processors)
+	c.errs.Fail("cpuinfo", err)
+	return c.errs.Err()
+}
+
+var addressSizes = regexp.MustCompile(`^(\d+) bits physical, (\d+) bits virtual$`)
+
+func (c *cpuinfo) x86(p *Processor, l cpuinfoLine) bool {
+	switch v := l.value; l.key {
+	case "vendor_id":
+		p.Vendor = v
+	case "cpu family":
+		return c.int(l, &p.Family)
+	case "model":
+		return c.int(l, &p.ModelCode)
+	case "model name":
+		p.Model = v
+	case "stepping":
+		return c.int(l, &p.Stepping)
+	case "microcode":
+		return c.int(l, &p.Microcode)
+	case "cpu MHz":
+		p.Speed = v
+	case "cache size":
+		p.CacheSize = v
+	case "physical id":
+		return c.int(l, &p.PhysID)
+	case "siblings":
+		return c.int(l, &p.Siblings)
+	case "core id":
+		return c.int(l, &p.CoreID)
+	case "cpu cores":
+		return c.int(l, &p.Cores)
+	case "fpu":
+		p.FPU = v == "yes"
+	case "wp":
+		p.WriteProtect = v == "yes"
+	case "flags":
+		p.Flags = strings.Fields(v)
+	case "bugs":
+		p.Bugs = strings.Fields(v)
+	case "cache_alignment":
+		return c.int(l, &p.CacheAlignment)
+	case "address sizes":
+		m := addressSizes.FindStringSubmatch(v)
+		if m == nil {
+			c.warn(l, "%s is %q, not physical and virtual bits", l.key, v)
+			return false
+		}
+		p.AddressSizes.Physical, _ = strconv.ParseInt(m[1], 10, 64)
+		p.AddressSizes.Virtual, _ = strconv.ParseInt(m[2], 10, 64)
+	default:
+		return false
+	}
+	return true
+}
+
+func (i *Info) fillGenericCPUInfo(env *plugins.Env) error {
+	c, err := readCPUInfo(env)
+	return i.fill(c, err, c.x86, nil)
+}
@@ -0,0 +1,160 @@
+package system
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rackn/gohai/plugins"
+)
+
+// armCores are the makers of ARM cores, by the implementer code in
+// their MIDR, and the names of their cores by part number.
+var armCores = map[int64]struct {
+	name  string
+	parts map[int64]string
+}{
+	0x41: {"ARM", map[int64]string{
+		0xd03: "Cortex-A53",
+		0xd04: "Cortex-A35",
+		0xd05: "Cortex-A55",
+		0xd07: "Cortex-A57",
+		0xd08: "Cortex-A72",
+		0xd09: "Cortex-A73",
+		0xd0a: "Cortex-A75",
+		0xd0b: "Cortex-A76",
+		0xd0c: "Neoverse-N1",
+		0xd0d: "Cortex-A77",
+		0xd40: "Neoverse-V1",
+		0xd41: "Cortex-A78",
+		0xd44: "Cortex-X1",
+		0xd46: "Cortex-A510",
+		0xd47: "Cortex-A710",
+		0xd48: "Cortex-X2",
+		0xd49: "Neoverse-N2",
+		0xd4a: "Neoverse-E1",
+		0xd4f: "Neoverse-V2",
+	}},
+	0x42: {"Broadcom", map[int64]string{
+		0x516: "Vulcan",
+	}},
+	0x43: {"Cavium", map[int64]string{
+		0x0a1: "ThunderX 88XX",
+		0x0a2: "ThunderX 81XX",
+		0x0a3: "ThunderX 83XX",
+		0x0af: "ThunderX2 99xx",
+		0x0b8: "ThunderX3 T110",
+	}},
+	0x46: {"Fujitsu", map[int64]string{
+		0x001: "A64FX",
+	}},
+	0x48: {"HiSilicon", map[int64]string{
+		0xd01: "Kunpeng-920",
+	}},
+	0x4e: {"NVIDIA", map[int64]string{
+		0x003: "Denver 2",
+		0x004: "Carmel",
+	}},
+	0x50: {"APM", map[int64]string{
+		0x000: "X-Gene",
+	}},
+	0x51: {"Qualcomm", map[int64]string{
+		0x800: "Falkor V1/Kryo",
+		0xc00: "Falkor",
+		0xc01: "Saphira",
+	}},
+	0x53: {"Samsung", map[int64]string{}},
+	0x56: {"Marvell", map[int64]string{}},
+	0x61: {"Apple", map[int64]string{}},
+	0x69: {"Intel", map[int64]string{}},
+	0xc0: {"Ampere", map[int64]string{
+		0xac3: "Ampere-1",
+		0xac4: "Ampere-1a",
+	}},
+}
+
+// decodeARM names the maker and core of an ARM processor from its
+// implementer and part codes.  Unknown codes are named by their value.
+func (p *Processor) decodeARM(implementer int64) {
+	maker, ok := armCores[implementer]
+	if !ok {
+		p.Vendor = fmt.Sprintf("0x%02x", implementer)
+		p.Model = fmt.Sprintf("0x%03x", p.ModelCode)
+		return
+	}
+	p.Vendor = maker.name
+	if p.Model, ok = maker.parts[p.ModelCode]; !ok {
+		p.Model = fmt.Sprintf("0x%03x", p.ModelCode)
+	}
+}
+
+// fillMIDR reads the Main ID Register of each processor, which Linux
+// 4.7 and later have in sysfs, and decodes the processors in partial
+// from it, which /proc/cpuinfo did not fully say what they are.
+func (i *Info) fillMIDR(env *plugins.Env, partial map[int64]bool) {
+	for ii := range i.Processors {
+		p := &i.Processors[ii]
+		buf, err := env.ReadFile(fmt.Sprintf("%s/cpu%d/regs/identification/midr_el1", cpuDir, p.ID))
+		if err != nil {
+			continue
+		}
+		midr, err := strconv.ParseUint(strings.TrimSpace(string(buf)), 0, 64)
+		if err != nil {
+			continue
+		}
+		p.MIDR = fmt.Sprintf("0x%08x", midr)
+		if !partial[p.ID] {
+			continue
+		}
+		p.Variant = int64(midr>>20) & 0xf
+		p.ModelCode = int64(midr>>4) & 0xfff
+		p.Stepping = int64(midr) & 0xf
+		p.decodeARM(int64(midr>>24) & 0xff)
+	}
+}
+
+func (i *Info) fillARMCPUInfo(env *plugins.Env) error {
+	c, err := readCPUInfo(env)
+	// implementer stays -1 unless the processor has a "CPU
+	// implementer" line that parses.  found counts the lines for the
+	// fields of the MIDR that parse, and processors without all four
+	// are left for fillMIDR to decode.
+	implementer := int64(-1)
+	found := 0
+	partial := map[int64]bool{}
+	midrField := func(l cpuinfoLine, dest *int64) bool {
+		if !c.int(l, dest) {
+			return false
+		}
+		found++
+		return true
+	}
+	arm := func(p *Processor, l cpuinfoLine) bool {
+		switch l.key {
+		case "CPU implementer":
+			return midrField(l, &implementer)
+		case "CPU architecture":
+			return c.int(l, &p.Family)
+		case "CPU variant":
+			return midrField(l, &p.Variant)
+		case "CPU part":
+			return midrField(l, &p.ModelCode)
+		case "CPU revision":
+			return midrField(l, &p.Stepping)
+		case "Features":
+			p.Flags = strings.Fields(l.value)
+		default:
+			return false
+		}
+		return true
+	}
+	err = i.fill(c, err, arm, func(p *Processor) {
+		if implementer >= 0 {
+			p.decodeARM(implementer)
+		}
+		partial[p.ID] = found < 4
+		implementer, found = -1, 0
+	})
+	i.fillMIDR(env, partial)
+	return err
+}
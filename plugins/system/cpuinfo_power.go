@@ -0,0 +1,28 @@
+package system
+
+import (
+	"github.com/rackn/gohai/plugins"
+)
+
+func (c *cpuinfo) power(p *Processor, l cpuinfoLine) bool {
+	switch l.key {
+	case "cpu":
+		p.Model = l.value
+	case "clock":
+		p.Speed = l.value
+	case "model":
+		// The model of the machine, in the lines for every
+		// processor.
+		p.Vendor = l.value
+	default:
+		return false
+	}
+	return true
+}
+
+func (i *Info) fillPowerCPUInfo(env *plugins.Env) error {
+	c, err := readCPUInfo(env)
+	return i.fill(c, err, c.power, func(p *Processor) {
+		p.Cores = 1
+	})
+}
@@ -0,0 +1,172 @@
+package system
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rackn/gohai/plugins"
+)
+
+// NUMANode is a NUMA node: the CPUs and memory in it, and the devices
+// attached to it.
+type NUMANode struct {
+	ID     int64
+	CPUs   []int64
+	Memory struct {
+		Total int64
+		Free  int64
+	}
+	// Distances are the relative costs of reaching the memory of
+	// each node from this one, in the order of the nodes.
+	Distances []int64
+	// PCIDevices are the addresses of the PCI devices of the network
+	// interfaces and disks attached to the node.
+	PCIDevices []string
+	// Interfaces are the network interfaces attached to the node, as
+	// Networking.Interfaces names them.
+	Interfaces []string
+	// Disks are the disks attached to the node, as Storage.Disks
+	// names them.
+	Disks []string
+}
+
+const nodeDir = "/sys/devices/system/node"
+
+var (
+	nodeRE   = regexp.MustCompile(`^node([0-9]+)$`)
+	pciDevRE = regexp.MustCompile(`^[0-9a-f]{4,}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+)
+
+// pciDevice returns the address of the PCI device the sysfs entry at p
+// is for, or "" if it is not on one.
+func pciDevice(env *plugins.Env, p string) string {
+	target, err := env.Readlink(p)
+	if err != nil {
+		return ""
+	}
+	for dev := path.Join(path.Dir(p), target); dev != "/"; dev = path.Dir(dev) {
+		if pciDevRE.MatchString(path.Base(dev)) {
+			return path.Base(dev)
+		}
+	}
+	return ""
+}
+
+// fillMemInfo reads the meminfo of a node, whose lines are like
+// "Node 0 MemTotal:       65852652 kB".
+func (n *NUMANode) fillMemInfo(buf []byte) error {
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		var dest *int64
+		switch fields[2] {
+		case "MemTotal:":
+			dest = &n.Memory.Total
+		case "MemFree:":
+			dest = &n.Memory.Free
+		default:
+			continue
+		}
+		sz, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		*dest = sz << 10
+	}
+	return nil
+}
+
+// fillNUMA reads the NUMA nodes from sysfs, and finds the network
+// interfaces and disks attached to each.  Kernels built without NUMA
+// support have no nodes, and leave NUMA empty.  Nodes that cannot be
+// read in full are warned about.
+func (i *Info) fillNUMA(env *plugins.Env) error {
+	ents, err := env.ReadDir(nodeDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return &plugins.StepError{Step: "numa", Err: err, Warning: true}
+	}
+	errs := plugins.Errors{}
+	nodes := []NUMANode{}
+	byID := map[int64]int{}
+	for _, ent := range ents {
+		m := nodeRE.FindStringSubmatch(ent.Name())
+		if m == nil {
+			continue
+		}
+		dir := path.Join(nodeDir, ent.Name())
+		node := NUMANode{
+			CPUs:       []int64{},
+			Distances:  []int64{},
+			PCIDevices: []string{},
+			Interfaces: []string{},
+			Disks:      []string{},
+		}
+		node.ID, _ = strconv.ParseInt(m[1], 10, 64)
+		if cpus, err := sysString(env, dir, "cpulist"); err == nil {
+			if node.CPUs, err = parseCPUList(cpus); err != nil {
+				errs.Warn(ent.Name(), err)
+				node.CPUs = []int64{}
+			}
+		}
+		if buf, err := env.ReadFile(path.Join(dir, "meminfo")); err == nil {
+			errs.Warn(ent.Name(), node.fillMemInfo(buf))
+		}
+		if dist, err := sysString(env, dir, "distance"); err == nil {
+			for _, d := range strings.Fields(dist) {
+				v, err := strconv.ParseInt(d, 10, 64)
+				if err != nil {
+					errs.Warn(ent.Name(), err)
+					break
+				}
+				node.Distances = append(node.Distances, v)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(a, b int) bool { return nodes[a].ID < nodes[b].ID })
+	for idx := range nodes {
+		byID[nodes[idx].ID] = idx
+	}
+	attach := func(p, name string, names func(n *NUMANode) *[]string) {
+		idx, ok := byID[env.NUMANode(p)]
+		if !ok {
+			return
+		}
+		node := &nodes[idx]
+		*names(node) = append(*names(node), name)
+		if dev := pciDevice(env, p); dev != "" {
+			for _, d := range node.PCIDevices {
+				if d == dev {
+					return
+				}
+			}
+			node.PCIDevices = append(node.PCIDevices, dev)
+		}
+	}
+	if ents, err := env.ReadDir("/sys/class/net"); err == nil {
+		for _, ent := range ents {
+			attach(path.Join("/sys/class/net", ent.Name()), ent.Name(),
+				func(n *NUMANode) *[]string { return &n.Interfaces })
+		}
+	}
+	if ents, err := env.ReadDir("/sys/block"); err == nil {
+		for _, ent := range ents {
+			attach(path.Join("/sys/block", ent.Name()), "/dev/"+ent.Name(),
+				func(n *NUMANode) *[]string { return &n.Disks })
+		}
+	}
+	for idx := range nodes {
+		sort.Strings(nodes[idx].PCIDevices)
+	}
+	i.NUMA = nodes
+	return errs.Err()
+}
@@ -0,0 +1,262 @@
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rackn/gohai/internal/fixtures"
+	"github.com/rackn/gohai/plugins"
+)
+
+func TestFixtures(t *testing.T) {
+	for _, m := range fixtures.Machines(t) {
+		m := m
+		t.Run(m.Name, func(t *testing.T) {
+			info, err := Gather(m.Env())
+			fixtures.Compare(t, filepath.Join("testdata", m.Name+".json"), m, "System", info, err)
+		})
+	}
+}
+
+func TestCPUInfoParsers(t *testing.T) {
+	for _, tc := range []struct {
+		machine string
+		count   int
+		model   string
+		vendor  string
+		cores   int64
+	}{
+		{"dell-r630-xeon-e5", 12, "Intel(R) Xeon(R) CPU E5-2603 v4 @ 1.70GHz", "GenuineIntel", 6},
+		{"supermicro-epyc-7232p", 16, "AMD EPYC 7232P 8-Core Processor", "AuthenticAMD", 8},
+		{"ibm-power8-lpar", 8, "POWER8 (architected), altivec supported", "IBM,8247-22L", 1},
+		{"ibm-power9-powernv", 4, "POWER9, altivec supported", "9006-22P", 1},
+		{"aws-graviton2", 4, "Neoverse-N1", "ARM", 0},
+	} {
+		m := fixtures.Lookup(t, tc.machine)
+		info, err := Gather(m.Env())
+		if err != nil {
+			t.Errorf("%s: %v", tc.machine, err)
+			continue
+		}
+		if info.ProcessorCount != tc.count || len(info.Processors) != tc.count {
+			t.Errorf("%s: got %d processors (%d parsed), want %d",
+				tc.machine, info.ProcessorCount, len(info.Processors), tc.count)
+			continue
+		}
+		for _, p := range info.Processors {
+			if p.Model != tc.model || p.Vendor != tc.vendor || p.Cores != tc.cores {
+				t.Errorf("%s: processor %d is %q/%q with %d cores, want %q/%q with %d",
+					tc.machine, p.ID, p.Vendor, p.Model, p.Cores, tc.vendor, tc.model, tc.cores)
+			}
+		}
+	}
+}
+
+func TestTopology(t *testing.T) {
+	for _, tc := range []struct {
+		machine                                 string
+		source                                  string
+		sockets, cores, threads, threadsPerCore int
+	}{
+		{"aws-graviton2", "sysfs", 1, 4, 4, 1},
+		{"dell-r630-xeon-e5", "sysfs", 2, 12, 12, 1},
+		{"docker-container", "cpuinfo", 1, 4, 8, 2},
+		{"ibm-power8-lpar", "sysfs", 1, 1, 8, 8},
+		{"ibm-power9-powernv", "sysfs", 1, 1, 4, 4},
+		{"qemu-kvm-guest", "sysfs", 2, 2, 2, 1},
+		{"supermicro-epyc-7232p", "sysfs", 1, 8, 16, 2},
+	} {
+		m := fixtures.Lookup(t, tc.machine)
+		info, err := Gather(m.Env())
+		if err != nil {
+			t.Errorf("%s: %v", tc.machine, err)
+			continue
+		}
+		topo := info.Topology
+		if topo.Source != tc.source || topo.Sockets != tc.sockets || topo.Cores != tc.cores ||
+			topo.Threads != tc.threads || topo.ThreadsPerCore != tc.threadsPerCore {
+			t.Errorf("%s: got %s %d/%d/%d/%d, want %s %d/%d/%d/%d", tc.machine,
+				topo.Source, topo.Sockets, topo.Cores, topo.Threads, topo.ThreadsPerCore,
+				tc.source, tc.sockets, tc.cores, tc.threads, tc.threadsPerCore)
+		}
+	}
+	for in, want := range map[string][]int64{
+		"":            {},
+		"5":           {5},
+		"0-3,8-9,12":  {0, 1, 2, 3, 8, 9, 12},
+		"0-1,16-17\n": {0, 1, 16, 17},
+		"0-x":         nil,
+	} {
+		got, _ := parseCPUList(in)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("CPU list %q parsed to %v, want %v", in, got, want)
+		}
+	}
+	for in, want := range map[string]int64{"32K": 32 << 10, "1024K": 1 << 20, "32M": 32 << 20, "512": 512} {
+		if got, err := parseCacheSize(in); err != nil || got != want {
+			t.Errorf("Cache size %q parsed to %d (%v), want %d", in, got, err, want)
+		}
+	}
+	root, err := ioutil.TempDir("", "gohai-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "proc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cpuinfo := "processor\t: 0\nBogoMIPS\t: 50.00\n\nprocessor\t: 1\nBogoMIPS\t: 50.00\n\n"
+	if err := ioutil.WriteFile(filepath.Join(root, "proc", "cpuinfo"), []byte(cpuinfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info := &Info{Arch: "arm64"}
+	env := &plugins.Env{Root: root}
+	if err := info.fillCPUInfo(env); err != nil {
+		t.Fatal(err)
+	}
+	if err := info.fillTopology(env); err == nil || info.Topology != nil {
+		t.Errorf("Expected no topology without sysfs or IDs in cpuinfo, got %+v", info.Topology)
+	}
+}
+
+func TestNUMA(t *testing.T) {
+	info, err := Gather(fixtures.Lookup(t, "dell-r630-xeon-e5").Env())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.NUMA) != 2 {
+		t.Fatalf("Got %d NUMA nodes, want 2", len(info.NUMA))
+	}
+	for i, tc := range []struct {
+		cpus       []int64
+		distances  []int64
+		interfaces []string
+		disks      []string
+	}{
+		{[]int64{0, 2, 4, 6, 8, 10}, []int64{10, 21}, []string{"eno1", "eno2", "eno3", "eno4"}, []string{"/dev/sda", "/dev/sr0"}},
+		{[]int64{1, 3, 5, 7, 9, 11}, []int64{21, 10}, []string{}, []string{}},
+	} {
+		node := info.NUMA[i]
+		if !reflect.DeepEqual(node.CPUs, tc.cpus) || !reflect.DeepEqual(node.Distances, tc.distances) ||
+			!reflect.DeepEqual(node.Interfaces, tc.interfaces) || !reflect.DeepEqual(node.Disks, tc.disks) {
+			t.Errorf("Node %d is %+v", node.ID, node)
+		}
+		if node.Memory.Total == 0 || node.Memory.Free > node.Memory.Total {
+			t.Errorf("Node %d has %d of %d bytes free", node.ID, node.Memory.Free, node.Memory.Total)
+		}
+	}
+}
+
+func TestARMDecode(t *testing.T) {
+	for _, tc := range []struct {
+		implementer, part int64
+		vendor, model     string
+	}{
+		{0x41, 0xd0c, "ARM", "Neoverse-N1"},
+		{0x43, 0x0af, "Cavium", "ThunderX2 99xx"},
+		{0xc0, 0xac3, "Ampere", "Ampere-1"},
+		{0x41, 0xfff, "ARM", "0xfff"},
+		{0x99, 0x001, "0x99", "0x001"},
+	} {
+		p := &Processor{ModelCode: tc.part}
+		p.decodeARM(tc.implementer)
+		if p.Vendor != tc.vendor || p.Model != tc.model {
+			t.Errorf("0x%x/0x%x decoded to %q/%q, want %q/%q",
+				tc.implementer, tc.part, p.Vendor, p.Model, tc.vendor, tc.model)
+		}
+	}
+	// Kernels that leave the CPU lines out of /proc/cpuinfo, or that
+	// have ones that do not parse, still have the MIDR in sysfs, which
+	// is decoded instead.
+	root, err := ioutil.TempDir("", "gohai-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	regs := filepath.Join(root, "sys/devices/system/cpu/cpu0/regs/identification")
+	if err := os.MkdirAll(regs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "proc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(regs, "midr_el1"), []byte("0x00000000431f0af1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		cpuinfo string
+		other   map[string]string
+		warns   bool
+	}{
+		{"processor\t: 0\nBogoMIPS\t: 50.00\n\n", map[string]string{"BogoMIPS": "50.00"}, false},
+		{"processor\t: 0\nBogoMIPS\t: 50.00\nCPU implementer\t: garbage\n\n",
+			map[string]string{"BogoMIPS": "50.00", "CPU implementer": "garbage"}, true},
+		{"processor\t: 0\nCPU implementer\t: 0x43\nCPU variant\t: 0x1\nCPU part\t: garbage\nCPU revision\t: 1\n\n",
+			map[string]string{"CPU part": "garbage"}, true},
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, "proc", "cpuinfo"), []byte(tc.cpuinfo), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info := &Info{Arch: "arm64"}
+		if err := info.fillCPUInfo(&plugins.Env{Root: root}); (err != nil) != tc.warns {
+			t.Errorf("%q: got error %v", tc.cpuinfo, err)
+		}
+		want := Processor{Vendor: "Cavium", Model: "ThunderX2 99xx", ModelCode: 0x0af, Variant: 1, Stepping: 1, MIDR: "0x431f0af1",
+			Other: tc.other}
+		if len(info.Processors) != 1 || !reflect.DeepEqual(info.Processors[0], want) {
+			t.Errorf("%q: got processors %+v, want %+v", tc.cpuinfo, info.Processors, want)
+		}
+	}
+}
+
+func TestCPUInfoProblems(t *testing.T) {
+	root, err := ioutil.TempDir("", "gohai-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "proc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// No blank line after the last processor, and values a parser
+	// that expects what x86 kernels print now would choke on.
+	cpuinfo := "processor\t: 0\nvendor_id\t: GenuineIntel\ncpu family\t: six\nmicrocode\t: 0xffffffffffffffff\n" +
+		"address sizes\t: 48 bits virtual\nnew field\t: 42\n\ngarbage\nprocessor\t: 1\nvendor_id\t: GenuineIntel"
+	if err := ioutil.WriteFile(filepath.Join(root, "proc", "cpuinfo"), []byte(cpuinfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info := &Info{Arch: "amd64"}
+	err = info.fillCPUInfo(&plugins.Env{Root: root})
+	if info.ProcessorCount != 2 || len(info.Processors) != 2 {
+		t.Fatalf("Got %d processors (%d parsed), want 2", info.ProcessorCount, len(info.Processors))
+	}
+	// Values that do not parse are kept as they are in Other, rather
+	// than lost.
+	p := info.Processors[0]
+	if p.Vendor != "GenuineIntel" || p.Family != 0 || p.Microcode != -1 {
+		t.Errorf("Processor 0 is %+v", p)
+	}
+	want := map[string]string{"new field": "42", "address sizes": "48 bits virtual", "cpu family": "six"}
+	if !reflect.DeepEqual(p.Other, want) {
+		t.Errorf("Other is %v, want %v", p.Other, want)
+	}
+	if info.Processors[1].ID != 1 || info.Processors[1].Vendor != "GenuineIntel" {
+		t.Errorf("Processor 1 is %+v", info.Processors[1])
+	}
+	problems := &plugins.Problems{}
+	problems.Add("System", err)
+	got := []string{}
+	for _, w := range problems.Warnings {
+		got = append(got, w.Error)
+	}
+	if wantWarnings := []string{
+		`Line 8 is not key: value`,
+		`Line 3: cpu family is "six", not a number`,
+		`Line 5: address sizes is "48 bits virtual", not physical and virtual bits`,
+	}; len(problems.Errors) != 0 || !reflect.DeepEqual(got, wantWarnings) {
+		t.Errorf("Got errors %+v and warnings %q, want warnings %q", problems.Errors, got, wantWarnings)
+	}
+}
@@ -0,0 +1,343 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rackn/gohai/plugins"
+)
+
+// Topology is how the logical CPUs of a system are laid out in
+// packages (sockets), dies, cores and threads, and the caches they
+// share.
+type Topology struct {
+	// Source is where the topology came from: sysfs, or cpuinfo on
+	// systems without /sys/devices/system/cpu, which has no caches.
+	Source string
+	// Sockets is the number of packages.
+	Sockets int
+	// Cores is the number of physical cores.
+	Cores int
+	// Threads is the number of logical CPUs.
+	Threads int
+	// ThreadsPerCore is the most threads any one core has.
+	ThreadsPerCore int
+	Packages       []Package
+	Caches         []Cache
+}
+
+// Package is a physical package, which usually fills a socket.
+type Package struct {
+	ID   int64
+	Dies []Die
+}
+
+// Die is a die in a package.  Kernels that do not know about dies
+// put every core of a package in die 0.
+type Die struct {
+	ID    int64
+	Cores []Core
+}
+
+// Core is a physical core, with the logical CPUs that are its
+// hardware threads.
+type Core struct {
+	ID      int64
+	Threads []int64
+}
+
+// Cache is one kind of cache, like the L1 data caches of the cores.
+// There are Count of them, each of Size bytes and shared by SharedBy
+// logical CPUs.
+type Cache struct {
+	Level    int64
+	Type     string
+	Size     int64
+	Ways     int64
+	LineSize int64
+	Count    int
+	SharedBy int
+	// Shared lists the logical CPUs that share each of them.
+	Shared [][]int64
+}
+
+// cpuTopo is where one logical CPU is.
+type cpuTopo struct {
+	id, pkg, die, core int64
+	// siblings tells the cores of a package apart, as core IDs do
+	// not on every architecture.
+	siblings string
+}
+
+// parseCPUList parses the lists of CPUs sysfs has, like "0-3,8-11".
+func parseCPUList(s string) ([]int64, error) {
+	res := []int64{}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return res, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		lo, err := strconv.ParseInt(bounds[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		hi := lo
+		if len(bounds) == 2 {
+			if hi, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		for c := lo; c <= hi; c++ {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+// parseCacheSize parses cache sizes like "32K" into bytes.
+func parseCacheSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	shift := uint(0)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+	res, err := strconv.ParseInt(s, 10, 64)
+	return res << shift, err
+}
+
+const cpuDir = "/sys/devices/system/cpu"
+
+var cpuRE = regexp.MustCompile(`^cpu([0-9]+)$`)
+
+func sysString(env *plugins.Env, p ...string) (string, error) {
+	buf, err := env.ReadFile(path.Join(p...))
+	return strings.TrimSpace(string(buf)), err
+}
+
+func sysInt(env *plugins.Env, p ...string) (int64, error) {
+	s, err := sysString(env, p...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// cacheKey identifies a kind of cache.
+type cacheKey struct {
+	level, size, ways, lineSize int64
+	typ                         string
+	sharedBy                    int
+}
+
+// sysfsTopology reads the topology of each online CPU, and its caches,
+// from /sys/devices/system/cpu.  CPUs that are offline have no
+// topology, and are left out.
+func sysfsTopology(env *plugins.Env) ([]cpuTopo, []Cache, error) {
+	ents, err := env.ReadDir(cpuDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	cpus := []cpuTopo{}
+	kinds := map[cacheKey]*Cache{}
+	seen := map[string]bool{}
+	for _, ent := range ents {
+		m := cpuRE.FindStringSubmatch(ent.Name())
+		if m == nil {
+			continue
+		}
+		dir := path.Join(cpuDir, ent.Name())
+		c := cpuTopo{}
+		c.id, _ = strconv.ParseInt(m[1], 10, 64)
+		if c.core, err = sysInt(env, dir, "topology/core_id"); err != nil {
+			continue
+		}
+		if c.pkg, err = sysInt(env, dir, "topology/physical_package_id"); err != nil {
+			return nil, nil, err
+		}
+		// die_id is missing before Linux 5.2, and -1 on
+		// architectures that do not know about dies, as the
+		// package ID is on ones that do not know about packages.
+		c.die, _ = sysInt(env, dir, "topology/die_id")
+		if c.die < 0 {
+			c.die = 0
+		}
+		if c.pkg < 0 {
+			c.pkg = 0
+		}
+		if c.siblings, err = sysString(env, dir, "topology/thread_siblings_list"); err != nil {
+			return nil, nil, err
+		}
+		cpus = append(cpus, c)
+		indexes, err := env.ReadDir(path.Join(dir, "cache"))
+		if err != nil {
+			continue
+		}
+		for _, idx := range indexes {
+			if !strings.HasPrefix(idx.Name(), "index") {
+				continue
+			}
+			idxDir := path.Join(dir, "cache", idx.Name())
+			shared, err := sysString(env, idxDir, "shared_cpu_list")
+			if err != nil {
+				continue
+			}
+			k := cacheKey{}
+			k.level, _ = sysInt(env, idxDir, "level")
+			k.typ, _ = sysString(env, idxDir, "type")
+			id := fmt.Sprintf("%d/%s/%s", k.level, k.typ, shared)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			sharedCPUs, err := parseCPUList(shared)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", idxDir, err)
+			}
+			size, _ := sysString(env, idxDir, "size")
+			if k.size, err = parseCacheSize(size); err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", idxDir, err)
+			}
+			k.ways, _ = sysInt(env, idxDir, "ways_of_associativity")
+			k.lineSize, _ = sysInt(env, idxDir, "coherency_line_size")
+			k.sharedBy = len(sharedCPUs)
+			kind := kinds[k]
+			if kind == nil {
+				kind = &Cache{
+					Level:    k.level,
+					Type:     k.typ,
+					Size:     k.size,
+					Ways:     k.ways,
+					LineSize: k.lineSize,
+					SharedBy: k.sharedBy,
+					Shared:   [][]int64{},
+				}
+				kinds[k] = kind
+			}
+			kind.Count++
+			kind.Shared = append(kind.Shared, sharedCPUs)
+		}
+	}
+	caches := []Cache{}
+	for _, kind := range kinds {
+		sort.Slice(kind.Shared, func(i, j int) bool { return kind.Shared[i][0] < kind.Shared[j][0] })
+		caches = append(caches, *kind)
+	}
+	sort.Slice(caches, func(i, j int) bool {
+		a, b := caches[i], caches[j]
+		switch {
+		case a.Level != b.Level:
+			return a.Level < b.Level
+		case a.Type != b.Type:
+			return a.Type < b.Type
+		}
+		return a.Size < b.Size
+	})
+	return cpus, caches, nil
+}
+
+// cpuinfoTopology works out the topology from the physical and core
+// IDs of the processors in /proc/cpuinfo, which only x86 systems have.
+func (i *Info) cpuinfoTopology() []cpuTopo {
+	cpus := []cpuTopo{}
+	for _, p := range i.Processors {
+		if p.Siblings == 0 {
+			return nil
+		}
+		cpus = append(cpus, cpuTopo{
+			id:       p.ID,
+			pkg:      p.PhysID,
+			core:     p.CoreID,
+			siblings: strconv.FormatInt(p.CoreID, 10),
+		})
+	}
+	return cpus
+}
+
+// newTopology builds the tree of packages, dies and cores the CPUs
+// are in, and counts them.
+func newTopology(source string, cpus []cpuTopo, caches []Cache) *Topology {
+	res := &Topology{Source: source, Threads: len(cpus), Caches: caches}
+	type coreKey struct {
+		pkg, die int64
+		siblings string
+	}
+	pkgs := map[int64]*Package{}
+	dies := map[[2]int64]*Die{}
+	cores := map[coreKey]*Core{}
+	coreOrder := []coreKey{}
+	for _, c := range cpus {
+		if pkgs[c.pkg] == nil {
+			pkgs[c.pkg] = &Package{ID: c.pkg}
+		}
+		if dies[[2]int64{c.pkg, c.die}] == nil {
+			dies[[2]int64{c.pkg, c.die}] = &Die{ID: c.die, Cores: []Core{}}
+		}
+		k := coreKey{c.pkg, c.die, c.siblings}
+		if cores[k] == nil {
+			cores[k] = &Core{ID: c.core, Threads: []int64{}}
+			coreOrder = append(coreOrder, k)
+		}
+		cores[k].Threads = append(cores[k].Threads, c.id)
+	}
+	for _, k := range coreOrder {
+		core := cores[k]
+		sort.Slice(core.Threads, func(i, j int) bool { return core.Threads[i] < core.Threads[j] })
+		if len(core.Threads) > res.ThreadsPerCore {
+			res.ThreadsPerCore = len(core.Threads)
+		}
+		die := dies[[2]int64{k.pkg, k.die}]
+		die.Cores = append(die.Cores, *core)
+	}
+	for k, die := range dies {
+		sort.Slice(die.Cores, func(i, j int) bool {
+			a, b := die.Cores[i], die.Cores[j]
+			if a.ID != b.ID {
+				return a.ID < b.ID
+			}
+			return a.Threads[0] < b.Threads[0]
+		})
+		pkgs[k[0]].Dies = append(pkgs[k[0]].Dies, *die)
+	}
+	res.Packages = []Package{}
+	for _, pkg := range pkgs {
+		sort.Slice(pkg.Dies, func(i, j int) bool { return pkg.Dies[i].ID < pkg.Dies[j].ID })
+		res.Packages = append(res.Packages, *pkg)
+	}
+	sort.Slice(res.Packages, func(i, j int) bool { return res.Packages[i].ID < res.Packages[j].ID })
+	res.Sockets = len(res.Packages)
+	res.Cores = len(cores)
+	return res
+}
+
+// fillTopology reads the topology from sysfs, or failing that works
+// it out from /proc/cpuinfo, which has to have been read already.
+func (i *Info) fillTopology(env *plugins.Env) error {
+	cpus, caches, err := sysfsTopology(env)
+	if err == nil && len(cpus) > 0 {
+		i.Topology = newTopology("sysfs", cpus, caches)
+		return nil
+	}
+	if cpus := i.cpuinfoTopology(); len(cpus) > 0 {
+		i.Topology = newTopology("cpuinfo", cpus, []Cache{})
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return errors.New("Neither sysfs nor /proc/cpuinfo describe the CPU topology")
+}
@@ -0,0 +1,282 @@
+// Package push uploads documents gohai wrote to an HTTP endpoint,
+// retrying with exponential backoff while the endpoint is unavailable
+// and, failing that, keeping them in a spool directory until it is
+// back.
+package push
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Client POSTs documents to URL.
+type Client struct {
+	// URL is where documents are posted to.
+	URL string
+	// ContentType is the content type documents are posted as.
+	ContentType string
+	// Header holds extra headers to send with every request.
+	Header http.Header
+	// Token, if set, is sent as a bearer token.
+	Token string
+	// Gzip compresses documents before they are posted.
+	Gzip bool
+	// Retries is how many more times to try posting a document when
+	// the endpoint cannot be reached or fails.
+	Retries int
+	// Backoff is how long to wait before the first retry.  Each retry
+	// after that waits twice as long as the one before, up to
+	// MaxBackoff if it is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout, if set, limits how long each try can take, so that an
+	// endpoint that stops answering is retried rather than waited on
+	// for ever.
+	Timeout time.Duration
+	// SpoolDir, if set, is where documents that could not be posted
+	// are kept until they can be.
+	SpoolDir string
+	// HTTPClient is used to post documents.  It defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// statusError is a response from the endpoint that was not a success.
+type statusError struct {
+	status string
+	body   string
+}
+
+func (e *statusError) Error() string {
+	if e.body == "" {
+		return e.status
+	}
+	return e.status + ": " + e.body
+}
+
+// permanent is an error that trying again will not fix.
+type permanent struct {
+	error
+}
+
+func (c *Client) request(ctx context.Context, doc []byte) (*http.Request, error) {
+	body := doc
+	if c.Gzip {
+		buf := &bytes.Buffer{}
+		zw := gzip.NewWriter(buf)
+		zw.Write(doc)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, vals := range c.Header {
+		for _, v := range vals {
+			req.Header.Add(k, v)
+		}
+	}
+	if c.ContentType != "" {
+		req.Header.Set("Content-Type", c.ContentType)
+	}
+	if c.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+// send posts doc once.
+func (c *Client) send(ctx context.Context, doc []byte) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	req, err := c.request(ctx, doc)
+	if err != nil {
+		return permanent{err}
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = &statusError{status: resp.Status, body: strings.TrimSpace(string(msg))}
+	// Anything but a server error, or being told to slow down,
+	// means the request itself is wrong.
+	if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests &&
+		resp.StatusCode != http.StatusRequestTimeout {
+		return permanent{err}
+	}
+	return err
+}
+
+// post posts doc, retrying as the Client says to.
+func (c *Client) post(ctx context.Context, doc []byte) error {
+	wait := c.Backoff
+	for try := 0; ; try++ {
+		err := c.send(ctx, doc)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(permanent); ok || try >= c.Retries || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		if wait *= 2; c.MaxBackoff > 0 && wait > c.MaxBackoff {
+			wait = c.MaxBackoff
+		}
+	}
+}
+
+// Post posts doc to the endpoint.  If the endpoint cannot be reached,
+// or keeps failing, doc is added to the spool directory and the error
+// says so.  Documents the endpoint turns down are not spooled.
+func (c *Client) Post(ctx context.Context, doc []byte) error {
+	err := c.post(ctx, doc)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(permanent); ok || c.SpoolDir == "" {
+		return fmt.Errorf("Failed to post document: %v", unwrap(err))
+	}
+	err = fmt.Errorf("Failed to post document: %v", err)
+	name, serr := c.spool(doc)
+	if serr != nil {
+		return fmt.Errorf("%v, and failed to spool the document: %v", err, serr)
+	}
+	return fmt.Errorf("%v, spooled the document to %s", err, name)
+}
+
+func unwrap(err error) error {
+	if p, ok := err.(permanent); ok {
+		return p.error
+	}
+	return err
+}
+
+// Spooled returns the paths of the documents in the spool directory,
+// oldest first.
+func (c *Client) Spooled() ([]string, error) {
+	if c.SpoolDir == "" {
+		return nil, nil
+	}
+	res, err := filepath.Glob(filepath.Join(c.SpoolDir, "gohai-*.doc"))
+	sort.Strings(res)
+	return res, err
+}
+
+// spooled is what is kept alongside a spooled document, so that it is
+// posted the way it would have been even if the Client that posts it
+// is set up differently.
+type spooled struct {
+	ContentType string
+	Gzip        bool
+}
+
+// metaFile is where what goes with the spooled document name is kept.
+func metaFile(name string) string {
+	return name + ".meta"
+}
+
+// Flush posts the documents in the spool directory, oldest first, and
+// removes them once they have been.  Each is posted with the content
+// type and encoding it was spooled with.  It returns how many were
+// posted, and stops at the first one that cannot be.  Documents the
+// endpoint turns down are set aside with a .rejected suffix instead,
+// so that they do not hold up the rest.
+func (c *Client) Flush(ctx context.Context) (int, error) {
+	names, err := c.Spooled()
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	var rejected error
+	for _, name := range names {
+		doc, err := ioutil.ReadFile(name)
+		if err != nil {
+			return sent, err
+		}
+		orig := *c
+		if buf, err := ioutil.ReadFile(metaFile(name)); err == nil {
+			meta := spooled{}
+			if err := json.Unmarshal(buf, &meta); err != nil {
+				return sent, fmt.Errorf("Spooled document %s: %v", name, err)
+			}
+			orig.ContentType, orig.Gzip = meta.ContentType, meta.Gzip
+		}
+		if err := orig.post(ctx, doc); err != nil {
+			if _, ok := err.(permanent); !ok {
+				return sent, fmt.Errorf("Failed to post spooled document %s: %v", name, err)
+			}
+			if rejected == nil {
+				rejected = fmt.Errorf("Spooled document %s was turned down: %v", name, unwrap(err))
+			}
+			os.Rename(name, name+".rejected")
+			os.Rename(metaFile(name), metaFile(name+".rejected"))
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			return sent, err
+		}
+		os.Remove(metaFile(name))
+		sent++
+	}
+	return sent, rejected
+}
+
+// spool adds doc to the spool directory.
+func (c *Client) spool(doc []byte) (string, error) {
+	if err := os.MkdirAll(c.SpoolDir, 0700); err != nil {
+		return "", err
+	}
+	name := filepath.Join(c.SpoolDir, fmt.Sprintf("gohai-%020d.doc", time.Now().UnixNano()))
+	meta, _ := json.Marshal(spooled{ContentType: c.ContentType, Gzip: c.Gzip})
+	// The document is renamed into place last, so that Flush never
+	// sees it without what goes with it.
+	for _, f := range []struct {
+		name string
+		buf  []byte
+	}{{metaFile(name), meta}, {name, doc}} {
+		tmp := f.name + ".tmp"
+		if err := ioutil.WriteFile(tmp, f.buf, 0600); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+		if err := os.Rename(tmp, f.name); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
@@ -0,0 +1,218 @@
+package push
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// endpoint is a stand-in for a provisioning server.  It fails with
+// each of its statuses in turn before it takes documents.
+type endpoint struct {
+	sync.Mutex
+	statuses []int
+	requests int
+	docs     []string
+	headers  []http.Header
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.Lock()
+	defer e.Unlock()
+	e.requests++
+	if len(e.statuses) > 0 {
+		status := e.statuses[0]
+		e.statuses = e.statuses[1:]
+		http.Error(w, "try again", status)
+		return
+	}
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	buf, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e.docs = append(e.docs, string(buf))
+	e.headers = append(e.headers, r.Header)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func TestPost(t *testing.T) {
+	e := &endpoint{statuses: []int{503, 429, 502}}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+	c := &Client{
+		URL:         ts.URL,
+		ContentType: "application/json; charset=utf-8",
+		Header:      http.Header{"X-Site": {"lab1"}},
+		Token:       "s3cret",
+		Gzip:        true,
+		Retries:     3,
+		Backoff:     time.Millisecond,
+	}
+	start := time.Now()
+	if err := c.Post(context.Background(), []byte(`{"System": {}}`)); err != nil {
+		t.Fatal(err)
+	}
+	// 1ms, 2ms and 4ms between the four tries.
+	if took := time.Since(start); took < 7*time.Millisecond {
+		t.Errorf("Retries only took %v", took)
+	}
+	if e.requests != 4 || len(e.docs) != 1 || e.docs[0] != `{"System": {}}` {
+		t.Fatalf("Endpoint got %d requests and %v", e.requests, e.docs)
+	}
+	h := e.headers[0]
+	for k, want := range map[string]string{
+		"Authorization":    "Bearer s3cret",
+		"X-Site":           "lab1",
+		"Content-Type":     "application/json; charset=utf-8",
+		"Content-Encoding": "gzip",
+	} {
+		if got := h.Get(k); got != want {
+			t.Errorf("%s is %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestPostFailures(t *testing.T) {
+	e := &endpoint{statuses: []int{400, 500, 500}}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+	c := &Client{URL: ts.URL, Retries: 5, Backoff: time.Millisecond}
+	// Documents the endpoint turns down are not retried.
+	err := c.Post(context.Background(), []byte("bad"))
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request: try again") || e.requests != 1 {
+		t.Errorf("Got %v after %d requests", err, e.requests)
+	}
+	c.Retries = 1
+	err = c.Post(context.Background(), []byte("doc"))
+	if err == nil || !strings.Contains(err.Error(), "500 Internal Server Error") || e.requests != 3 {
+		t.Errorf("Got %v after %d requests", err, e.requests)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c = &Client{URL: ts.URL, Retries: 5, Backoff: time.Hour}
+	if err := c.Post(ctx, []byte("doc")); err == nil {
+		t.Errorf("Expected a cancelled post to fail")
+	}
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohai-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Nothing listens on a server that has been closed.
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	c := &Client{URL: down.URL, Retries: 1, Backoff: time.Millisecond, SpoolDir: filepath.Join(dir, "spool")}
+	for _, doc := range []string{"first", "second"} {
+		err := c.Post(context.Background(), []byte(doc))
+		if err == nil || !strings.Contains(err.Error(), "spooled the document to") {
+			t.Fatalf("Posting %s got %v", doc, err)
+		}
+	}
+	if names, err := c.Spooled(); err != nil || len(names) != 2 {
+		t.Fatalf("Spooled %v, %v", names, err)
+	}
+	if n, err := c.Flush(context.Background()); err == nil || n != 0 {
+		t.Errorf("Flushing to an endpoint that is down sent %d, %v", n, err)
+	}
+	e := &endpoint{}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+	c.URL = ts.URL
+	if err := c.Post(context.Background(), []byte("third")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.Flush(context.Background()); err != nil || n != 2 {
+		t.Errorf("Flushing sent %d, %v", n, err)
+	}
+	if got := strings.Join(e.docs, ","); got != "third,first,second" {
+		t.Errorf("Endpoint got %s", got)
+	}
+	if names, _ := c.Spooled(); len(names) != 0 {
+		t.Errorf("%v are still spooled", names)
+	}
+	// Spooled documents the endpoint turns down are set aside.
+	c.URL = down.URL
+	c.Post(context.Background(), []byte("rejected"))
+	c.Post(context.Background(), []byte("fourth"))
+	e.statuses = []int{422}
+	c.URL = ts.URL
+	if n, err := c.Flush(context.Background()); err == nil || n != 1 {
+		t.Errorf("Flushing sent %d, %v", n, err)
+	}
+	if rejected, _ := filepath.Glob(filepath.Join(c.SpoolDir, "*.rejected")); len(rejected) != 1 {
+		t.Errorf("Set aside %v", rejected)
+	}
+	if e.docs[len(e.docs)-1] != "fourth" {
+		t.Errorf("Endpoint got %v", e.docs)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	stall := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stall
+	}))
+	defer ts.Close()
+	defer close(stall)
+	c := &Client{URL: ts.URL, Retries: 1, Backoff: time.Millisecond, Timeout: 20 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() { done <- c.Post(context.Background(), []byte("doc")) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Expected posting to an endpoint that stalls to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Posting to an endpoint that stalls did not give up")
+	}
+}
+
+func TestSpoolHeaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohai-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	c := &Client{URL: down.URL, ContentType: "application/yaml", Gzip: true, SpoolDir: dir}
+	if err := c.Post(context.Background(), []byte("yaml: doc")); err == nil {
+		t.Fatal("Expected posting to an endpoint that is down to fail")
+	}
+	// The next run writes JSON, and does not compress it.
+	e := &endpoint{}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+	c = &Client{URL: ts.URL, ContentType: "application/json", SpoolDir: dir}
+	if n, err := c.Flush(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Flushing sent %d, %v", n, err)
+	}
+	if len(e.docs) != 1 || e.docs[0] != "yaml: doc" ||
+		e.headers[0].Get("Content-Type") != "application/yaml" || e.headers[0].Get("Content-Encoding") != "gzip" {
+		t.Errorf("Endpoint got %q with %v", e.docs, e.headers)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) != 0 {
+		t.Errorf("%v are left in the spool directory", left)
+	}
+}
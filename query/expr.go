@@ -0,0 +1,261 @@
+package query
+
+import (
+	"reflect"
+)
+
+// expr is a condition, or part of one, in a filter.
+type expr interface {
+	eval(v interface{}) interface{}
+}
+
+type literal struct {
+	val interface{}
+}
+
+func (l literal) eval(interface{}) interface{} {
+	return l.val
+}
+
+func (p path) expr() expr {
+	return pathExpr(p)
+}
+
+type pathExpr path
+
+func (p pathExpr) eval(v interface{}) interface{} {
+	return path(p).eval(v)
+}
+
+type not struct {
+	e expr
+}
+
+func (n not) eval(v interface{}) interface{} {
+	return !truthy(n.e.eval(v))
+}
+
+type and []expr
+
+func (a and) eval(v interface{}) interface{} {
+	for _, e := range a {
+		if !truthy(e.eval(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+type or []expr
+
+func (o or) eval(v interface{}) interface{} {
+	for _, e := range o {
+		if truthy(e.eval(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+type compare struct {
+	op   string
+	l, r expr
+}
+
+func (c compare) eval(v interface{}) interface{} {
+	l, r := c.l.eval(v), c.r.eval(v)
+	switch c.op {
+	case "==":
+		return equal(l, r)
+	case "!=":
+		return !equal(l, r)
+	}
+	cmp, ok := order(l, r)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// truthy returns whether v counts as true in a condition.
+func truthy(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case string:
+		return val != ""
+	case []interface{}:
+		return len(val) > 0
+	case map[string]interface{}:
+		return len(val) > 0
+	}
+	return true
+}
+
+func number(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
+	}
+	return 0, false
+}
+
+func equal(l, r interface{}) bool {
+	if ln, ok := number(l); ok {
+		rn, ok := number(r)
+		return ok && ln == rn
+	}
+	return reflect.DeepEqual(l, r)
+}
+
+// order compares two numbers or two strings.  ok is false for
+// anything else.
+func order(l, r interface{}) (res int, ok bool) {
+	if ln, ok := number(l); ok {
+		rn, ok := number(r)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case ln < rn:
+			return -1, true
+		case ln > rn:
+			return 1, true
+		}
+		return 0, true
+	}
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if !lok || !rok {
+		return 0, false
+	}
+	switch {
+	case ls < rs:
+		return -1, true
+	case ls > rs:
+		return 1, true
+	}
+	return 0, true
+}
+
+var compareOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func (p *parser) parseOr() (expr, error) {
+	e, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	res := or{e}
+	for p.eat("||") {
+		if e, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	if len(res) == 1 {
+		return res[0], nil
+	}
+	return res, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	e, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	res := and{e}
+	for p.eat("&&") {
+		if e, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	if len(res) == 1 {
+		return res[0], nil
+	}
+	return res, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.eat("!") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{e}, nil
+	}
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range compareOps {
+		if p.eat(op) {
+			r, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return compare{op: op, l: l, r: r}, nil
+		}
+	}
+	return l, nil
+}
+
+func (p *parser) parseOperand() (expr, error) {
+	if p.eat("(") {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.eat(")") {
+			return nil, p.errorf("expected )")
+		}
+		return e, nil
+	}
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of query")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '"' || c == '\'':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return literal{s}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		n, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		return literal{n}, nil
+	}
+	start := p.pos
+	switch word := p.ident(); word {
+	case "true":
+		return literal{true}, nil
+	case "false":
+		return literal{false}, nil
+	case "null":
+		return literal{nil}, nil
+	}
+	p.pos = start
+	res, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return res.expr(), nil
+}
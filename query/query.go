@@ -0,0 +1,390 @@
+// Package query picks values out of what gohai gathered with a small
+// path language, so that scripts can get at single facts without
+// needing jq.
+//
+// A query is a path through the JSON form of the gathered
+// information:
+//
+//	DMI.System.SerialNumber          a field
+//	Networking.Interfaces[0]         an array item, negative counts from the end
+//	Networking.Addrs["10.0.0.1/24"]  a key that is not a plain name
+//	Networking.Interfaces[*].Name    every item of an array (or value of an object)
+//	Networking.HardwareAddrs.*       the same, written as a field
+//	Networking.Interfaces[?Sys.IsPhysical].HardwareAddr
+//	                                 the items for which a condition holds
+//
+// Field names are matched exactly, and then case-insensitively.  Once
+// a path has gone through [*] or a filter, the rest of the path is
+// applied to each of the items, and the result is an array of what
+// was found.
+//
+// Conditions in filters are paths relative to the item being tested
+// (@ is the item itself), literals ("strings", 'strings', numbers,
+// true, false and null), the comparisons == != < <= > >=, and !, &&,
+// || and parentheses.  A path on its own is true unless it is
+// missing, null, false, "" or an empty array or object.
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rackn/gohai/format"
+)
+
+// Query is a parsed query.
+type Query struct {
+	src  string
+	path path
+}
+
+// String returns the query as it was written.
+func (q *Query) String() string {
+	return q.src
+}
+
+// Root returns the field the query starts with, or "" if it does not
+// start with one.
+func (q *Query) Root() string {
+	if len(q.path.steps) == 0 {
+		return ""
+	}
+	if f, ok := q.path.steps[0].(field); ok {
+		return string(f)
+	}
+	return ""
+}
+
+// Eval runs the query against v, which is turned into its JSON form
+// first.  It returns nil if nothing matched.
+func (q *Query) Eval(v interface{}) (interface{}, error) {
+	tree, err := format.Tree(v)
+	if err != nil {
+		return nil, err
+	}
+	return q.path.eval(tree), nil
+}
+
+// Parse parses a query.
+func Parse(src string) (*Query, error) {
+	p := &parser{src: src}
+	p.skipSpace()
+	res, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return &Query{src: src, path: res}, nil
+}
+
+// step takes a value and returns what it leads to, which is empty
+// when nothing was found.  projects is true when the rest of the path
+// is to be applied to each of the results.
+type step interface {
+	apply(v interface{}) (res []interface{}, projects bool)
+}
+
+type field string
+
+func (f field) apply(v interface{}) ([]interface{}, bool) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if res, ok := obj[string(f)]; ok {
+		return []interface{}{res}, false
+	}
+	for k, res := range obj {
+		if strings.EqualFold(k, string(f)) {
+			return []interface{}{res}, false
+		}
+	}
+	return nil, false
+}
+
+type index int
+
+func (i index) apply(v interface{}) ([]interface{}, bool) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	n := int(i)
+	if n < 0 {
+		n += len(arr)
+	}
+	if n < 0 || n >= len(arr) {
+		return nil, false
+	}
+	return []interface{}{arr[n]}, false
+}
+
+// items returns the items of an array, or the values of an object
+// sorted by key.
+func items(v interface{}) []interface{} {
+	switch val := v.(type) {
+	case []interface{}:
+		return val
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		res := make([]interface{}, len(keys))
+		for i, k := range keys {
+			res[i] = val[k]
+		}
+		return res
+	}
+	return nil
+}
+
+type wildcard struct{}
+
+func (wildcard) apply(v interface{}) ([]interface{}, bool) {
+	return items(v), true
+}
+
+type filter struct {
+	cond expr
+}
+
+func (f filter) apply(v interface{}) ([]interface{}, bool) {
+	res := []interface{}{}
+	for _, item := range items(v) {
+		if truthy(f.cond.eval(item)) {
+			res = append(res, item)
+		}
+	}
+	return res, true
+}
+
+// path is a series of steps.
+type path struct {
+	steps []step
+}
+
+func (p path) eval(v interface{}) interface{} {
+	cur := []interface{}{v}
+	projected := false
+	for _, s := range p.steps {
+		next := []interface{}{}
+		for _, item := range cur {
+			res, projects := s.apply(item)
+			next = append(next, res...)
+			projected = projected || projects
+		}
+		cur = next
+	}
+	if projected {
+		return cur
+	}
+	if len(cur) == 0 {
+		return nil
+	}
+	return cur[0]
+}
+
+// IsScalar returns whether v, from the result of Eval, is a string,
+// number or bool.
+func IsScalar(v interface{}) bool {
+	switch v.(type) {
+	case string, bool, int64, float64:
+		return true
+	}
+	return false
+}
+
+// Lines returns the plain text form of v if it is a scalar or an
+// array of scalars, one value per line.  ok is false for anything
+// else.
+func Lines(v interface{}) (res []string, ok bool) {
+	if IsScalar(v) {
+		return []string{format.Scalar(v)}, true
+	}
+	arr, isArr := v.([]interface{})
+	if !isArr {
+		return nil, false
+	}
+	res = make([]string, len(arr))
+	for i := range arr {
+		if arr[i] != nil && !IsScalar(arr[i]) {
+			return nil, false
+		}
+		res[i] = format.Scalar(arr[i])
+	}
+	return res, true
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) errorf(f string, args ...interface{}) error {
+	return fmt.Errorf("Bad query %q at offset %d: %s", p.src, p.pos, fmt.Sprintf(f, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// eat consumes tok if it is next, after any spaces.
+func (p *parser) eat(tok string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func (p *parser) ident() string {
+	start := p.pos
+	if p.pos < len(p.src) && isIdentStart(p.src[p.pos]) {
+		for p.pos < len(p.src) && isIdent(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) parseString() (string, error) {
+	quote := p.src[p.pos]
+	for end := p.pos + 1; end < len(p.src); end++ {
+		switch p.src[end] {
+		case '\\':
+			end++
+		case quote:
+			raw := p.src[p.pos : end+1]
+			if quote == '\'' {
+				raw = `"` + strings.Replace(strings.Replace(raw[1:len(raw)-1], `\'`, `'`, -1), `"`, `\"`, -1) + `"`
+			}
+			res, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", p.errorf("bad string %s", p.src[p.pos:end+1])
+			}
+			p.pos = end + 1
+			return res, nil
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) parseNumber() (interface{}, error) {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte("+-0123456789.eE", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	s := p.src[start:p.pos]
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	p.pos = start
+	return nil, p.errorf("bad number %s", s)
+}
+
+// parseBracket parses what is between [ and ].
+func (p *parser) parseBracket() (step, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unterminated [")
+	}
+	var res step
+	switch c := p.src[p.pos]; {
+	case c == '*':
+		p.pos++
+		res = wildcard{}
+	case c == '?':
+		p.pos++
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		res = filter{cond: cond}
+	case c == '"' || c == '\'':
+		key, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		res = field(key)
+	case c == '-' || (c >= '0' && c <= '9'):
+		n, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		i, ok := n.(int64)
+		if !ok {
+			return nil, p.errorf("array index %v is not a whole number", n)
+		}
+		res = index(i)
+	default:
+		return nil, p.errorf("expected an index, a quoted key, * or ?condition")
+	}
+	if !p.eat("]") {
+		return nil, p.errorf("expected ]")
+	}
+	return res, nil
+}
+
+func (p *parser) parsePath() (path, error) {
+	res := path{}
+	p.skipSpace()
+	switch {
+	case p.eat("@"):
+	case p.eat("*"):
+		res.steps = append(res.steps, wildcard{})
+	case p.pos < len(p.src) && p.src[p.pos] == '[':
+	default:
+		name := p.ident()
+		if name == "" {
+			return res, p.errorf("expected a field name")
+		}
+		res.steps = append(res.steps, field(name))
+	}
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '.':
+			p.pos++
+			if p.pos < len(p.src) && p.src[p.pos] == '*' {
+				p.pos++
+				res.steps = append(res.steps, wildcard{})
+				continue
+			}
+			name := p.ident()
+			if name == "" {
+				return res, p.errorf("expected a field name after .")
+			}
+			res.steps = append(res.steps, field(name))
+		case '[':
+			p.pos++
+			s, err := p.parseBracket()
+			if err != nil {
+				return res, err
+			}
+			res.steps = append(res.steps, s)
+		default:
+			return res, nil
+		}
+	}
+	return res, nil
+}
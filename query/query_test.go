@@ -0,0 +1,140 @@
+package query
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sample = `{
+  "DMI": {"System": {"SerialNumber": "7XJ2K52"}},
+  "Networking": {
+    "Addrs": {"10.0.0.1/24": "eth0", "fe80::1/64": "eth0"},
+    "HardwareAddrs": {"24:6e:96:3c:5a:10": "eth0", "24:6e:96:3c:5a:11": "eth1"},
+    "Interfaces": [
+      {"Name": "lo", "MTU": 65536, "Sys": {"IsPhysical": false}, "Tags": []},
+      {"Name": "eth0", "MTU": 9000, "HardwareAddr": "24:6e:96:3c:5a:10",
+       "Sys": {"IsPhysical": true, "Driver": "ixgbe"}, "Tags": ["up", "lacp"]},
+      {"Name": "eth1", "MTU": 1500, "HardwareAddr": "24:6e:96:3c:5a:11",
+       "Sys": {"IsPhysical": true, "Driver": "igb"}, "Tags": ["down"]},
+      {"Name": "br0", "MTU": 1500, "Sys": {"IsPhysical": false, "Driver": null}, "Tags": ["up"]}
+    ]
+  },
+  "System": {"ProcessorCount": 12, "Load": 0.5}
+}`
+
+func TestEval(t *testing.T) {
+	var tree interface{}
+	if err := json.Unmarshal([]byte(sample), &tree); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{`DMI.System.SerialNumber`, `"7XJ2K52"`},
+		{`dmi.system.serialnumber`, `"7XJ2K52"`},
+		{`System.ProcessorCount`, `12`},
+		{`System.Load`, `0.5`},
+		{`DMI.System.Missing`, `null`},
+		{`Networking.Interfaces[1].Name`, `"eth0"`},
+		{`Networking.Interfaces[-1].Name`, `"br0"`},
+		{`Networking.Interfaces[9].Name`, `null`},
+		{`Networking.Addrs["10.0.0.1/24"]`, `"eth0"`},
+		{`Networking.Addrs['fe80::1/64']`, `"eth0"`},
+		{`Networking["Interfaces"][0]["Name"]`, `"lo"`},
+		{`Networking.Interfaces[*].Name`, `["lo","eth0","eth1","br0"]`},
+		{`Networking.HardwareAddrs.*`, `["eth0","eth1"]`},
+		{`Networking.HardwareAddrs[*]`, `["eth0","eth1"]`},
+		{`Networking.Interfaces[?Sys.IsPhysical].HardwareAddr`, `["24:6e:96:3c:5a:10","24:6e:96:3c:5a:11"]`},
+		{`Networking.Interfaces[?!Sys.IsPhysical].Name`, `["lo","br0"]`},
+		{`Networking.Interfaces[?HardwareAddr].Name`, `["eth0","eth1"]`},
+		{`Networking.Interfaces[?Sys.Driver == "igb"].Name`, `["eth1"]`},
+		{`Networking.Interfaces[?Sys.Driver != null].Name`, `["eth0","eth1"]`},
+		{`Networking.Interfaces[?MTU >= 1500 && MTU < 9000].Name`, `["eth1","br0"]`},
+		{`Networking.Interfaces[?MTU > 9000 || Name == 'lo'].Name`, `["lo"]`},
+		{`Networking.Interfaces[?(MTU == 1500 || MTU == 9000) && Sys.IsPhysical].Name`, `["eth0","eth1"]`},
+		{`Networking.Interfaces[?Tags].Name`, `["eth0","eth1","br0"]`},
+		{`Networking.Interfaces[?Tags[?@ == "up"]].Name`, `["eth0","br0"]`},
+		{`Networking.Interfaces[*].Tags[0]`, `["up","down","up"]`},
+		{`Networking.Interfaces[?Name == "nope"].Name`, `[]`},
+		{`Networking.Interfaces[?Sys.IsPhysical].Sys`, `[{"Driver":"ixgbe","IsPhysical":true},{"Driver":"igb","IsPhysical":true}]`},
+	} {
+		q, err := Parse(tc.query)
+		if err != nil {
+			t.Errorf("%s: %v", tc.query, err)
+			continue
+		}
+		res, err := q.Eval(tree)
+		if err != nil {
+			t.Errorf("%s: %v", tc.query, err)
+			continue
+		}
+		got, _ := json.Marshal(res)
+		if string(got) != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`.Name`,
+		`Networking.`,
+		`Networking.Interfaces[`,
+		`Networking.Interfaces[1`,
+		`Networking.Interfaces[1.5]`,
+		`Networking.Interfaces[foo]`,
+		`Networking.Interfaces[?]`,
+		`Networking.Interfaces[?Name == ]`,
+		`Networking.Interfaces[?(Name]`,
+		`Networking.Addrs["10.0.0.1/24]`,
+		`Networking Interfaces`,
+	} {
+		if q, err := Parse(src); err == nil {
+			t.Errorf("%q: expected an error, got %#v", src, q)
+		} else if !strings.HasPrefix(err.Error(), "Bad query") {
+			t.Errorf("%q: unexpected error %v", src, err)
+		}
+	}
+}
+
+func TestRoot(t *testing.T) {
+	for src, want := range map[string]string{
+		`Networking.Interfaces[0]`: "Networking",
+		`DMI`:                      "DMI",
+		`["DMI"].System`:           "DMI",
+		`*.Arch`:                   "",
+	} {
+		q, err := Parse(src)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		if got := q.Root(); got != want {
+			t.Errorf("%s: got root %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	for _, tc := range []struct {
+		val  interface{}
+		want []string
+		ok   bool
+	}{
+		{"eth0", []string{"eth0"}, true},
+		{int64(12), []string{"12"}, true},
+		{true, []string{"true"}, true},
+		{[]interface{}{"a", int64(1), nil, 0.5}, []string{"a", "1", "", "0.5"}, true},
+		{[]interface{}{}, []string{}, true},
+		{[]interface{}{"a", map[string]interface{}{}}, nil, false},
+		{map[string]interface{}{"a": "b"}, nil, false},
+	} {
+		got, ok := Lines(tc.val)
+		if ok != tc.ok || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %q %v, want %q %v", tc.val, got, ok, tc.want, tc.ok)
+		}
+	}
+}
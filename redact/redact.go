@@ -0,0 +1,217 @@
+// Package redact pseudonymises the facts in a gohai document that
+// identify a system or its owner: serial numbers and UUIDs, MAC
+// addresses and IP addresses.
+//
+// Every value is replaced with one made from a hash of it, so the same
+// value is always replaced with the same pseudonym.  That keeps what
+// refers to what intact, like the HardwareAddrs keys of the Networking
+// class and the interfaces they name, and lets redacted documents be
+// compared with each other.  Pseudonyms have the shape of what they
+// replace: MAC addresses are locally administered MAC addresses of the
+// same length, IPv4 addresses are in 10.0.0.0/8 and IPv6 addresses
+// are unique local ones (link-local ones stay link-local), with the
+// prefix length of the original, and UUIDs are UUIDs.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/rackn/gohai/format"
+)
+
+// Redactor pseudonymises documents.
+type Redactor struct {
+	// Key, if set, is mixed into the hashes, so that pseudonyms
+	// cannot be turned back into the values they replace by hashing
+	// guesses.  Documents redacted with the same Key use the same
+	// pseudonyms.
+	Key []byte
+}
+
+// fields are the fields, by lower case name, whose values are
+// redacted.
+var fields = map[string]bool{
+	"serial":        true,
+	"serialnumber":  true,
+	"uuid":          true,
+	"hardwareaddr":  true,
+	"permanentaddr": true,
+	"macaddress":    true,
+	"mac":           true,
+	"addrs":         true,
+	"ip":            true,
+	"ipaddress":     true,
+}
+
+// keyed are the fields, by lower case name, that are objects whose
+// keys are redacted.
+var keyed = map[string]bool{
+	"hardwareaddrs": true,
+	"addrs":         true,
+}
+
+// unset are the values firmware fills serial numbers it has nothing
+// for with.  They say nothing about the system, so they are left
+// alone.
+var unset = map[string]bool{
+	"":                                     true,
+	"0":                                    true,
+	"none":                                 true,
+	"n/a":                                  true,
+	"not specified":                        true,
+	"not available":                        true,
+	"unknown":                              true,
+	"default string":                       true,
+	"to be filled by o.e.m.":               true,
+	"system serial number":                 true,
+	"0123456789":                           true,
+	"00000000-0000-0000-0000-000000000000": true,
+	"03000200-0400-0500-0006-000700080009": true,
+}
+
+var (
+	uuidRE = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	// enxRE matches the names systemd gives interfaces after their
+	// MAC address.
+	enxRE = regexp.MustCompile(`^enx([0-9a-f]{12})$`)
+)
+
+// hash returns n bytes of the hash of value, which is of kind.
+func (r *Redactor) hash(kind, value string, n int) []byte {
+	mac := hmac.New(sha256.New, r.Key)
+	fmt.Fprintf(mac, "%s:%s", kind, value)
+	sum := mac.Sum(nil)
+	for len(sum) < n {
+		sum = append(sum, r.hash(kind, hex.EncodeToString(sum), sha256.Size)...)
+	}
+	return sum[:n]
+}
+
+func (r *Redactor) mac(hw net.HardwareAddr) string {
+	h := r.hash("mac", hw.String(), len(hw))
+	// Locally administered and unicast, so they cannot be mistaken
+	// for a real vendor's.
+	h[0] = h[0]&^0x01 | 0x02
+	return net.HardwareAddr(h).String()
+}
+
+func (r *Redactor) ip(ip net.IP) net.IP {
+	switch {
+	case ip.IsLoopback() || ip.IsUnspecified():
+		return ip
+	case ip.To4() != nil:
+		h := r.hash("ip", ip.String(), 3)
+		return net.IP{10, h[0], h[1], h[2]}
+	case ip.IsLinkLocalUnicast():
+		// The interface ID of link-local addresses is often made
+		// from the MAC address.
+		res := make(net.IP, net.IPv6len)
+		copy(res, ip[:8])
+		copy(res[8:], r.hash("ip", ip.String(), 8))
+		return res
+	}
+	return append(net.IP{0xfd}, r.hash("ip", ip.String(), 15)...)
+}
+
+// Value returns the pseudonym for s, picked by what s looks like: a
+// MAC address, an IP address with or without a prefix length, a
+// UUID, or anything else, like a serial number.
+func (r *Redactor) Value(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if unset[strings.ToLower(trimmed)] {
+		return s
+	}
+	if strings.ContainsAny(trimmed, ":-.") {
+		if hw, err := net.ParseMAC(trimmed); err == nil {
+			return r.mac(hw)
+		}
+	}
+	if ip := net.ParseIP(trimmed); ip != nil {
+		return r.ip(ip).String()
+	}
+	if ip, network, err := net.ParseCIDR(trimmed); err == nil {
+		ones, _ := network.Mask.Size()
+		return fmt.Sprintf("%s/%d", r.ip(ip), ones)
+	}
+	if uuidRE.MatchString(trimmed) {
+		h := hex.EncodeToString(r.hash("uuid", strings.ToLower(trimmed), 16))
+		return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+	}
+	return "redacted-" + hex.EncodeToString(r.hash("id", trimmed, 6))
+}
+
+// name redacts the MAC address in interface names made from one.
+func (r *Redactor) name(s string) string {
+	m := enxRE.FindStringSubmatch(s)
+	if m == nil {
+		return s
+	}
+	hw, _ := hex.DecodeString(m[1])
+	return "enx" + strings.Replace(r.mac(hw), ":", "", -1)
+}
+
+// all redacts every string in v.
+func (r *Redactor) all(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return r.Value(val)
+	case []interface{}:
+		for i := range val {
+			val[i] = r.all(val[i])
+		}
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = r.all(val[k])
+		}
+	}
+	return v
+}
+
+func (r *Redactor) walk(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return r.name(val)
+	case []interface{}:
+		for i := range val {
+			val[i] = r.walk(val[i])
+		}
+	case map[string]interface{}:
+		for k, item := range val {
+			lower := strings.ToLower(k)
+			switch obj, isObj := item.(map[string]interface{}); {
+			case keyed[lower] && isObj:
+				res := make(map[string]interface{}, len(obj))
+				for key, item := range obj {
+					res[r.Value(key)] = r.walk(item)
+				}
+				val[k] = res
+			case fields[lower]:
+				val[k] = r.all(item)
+			default:
+				val[k] = r.walk(item)
+			}
+		}
+	}
+	return v
+}
+
+// Redact returns v, a gohai document or part of one, with the values
+// that identify the system replaced by pseudonyms.  The serial
+// numbers, UUIDs, MAC addresses and IP addresses in fields with the
+// names gohai and lshw use for them (in any class), the keys of the
+// Networking class's Addrs and HardwareAddrs, and interface names made
+// from MAC addresses are redacted.  Serial numbers that firmware left
+// unset, and loopback addresses, are kept as they are.
+func (r *Redactor) Redact(v interface{}) (interface{}, error) {
+	tree, err := format.Tree(v)
+	if err != nil {
+		return nil, err
+	}
+	return r.walk(tree), nil
+}
@@ -0,0 +1,159 @@
+package redact
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/rackn/gohai"
+	"github.com/rackn/gohai/format"
+	"github.com/rackn/gohai/internal/fixtures"
+)
+
+func TestValue(t *testing.T) {
+	r := &Redactor{}
+	for _, tc := range []struct {
+		in   string
+		want string // a regexp
+	}{
+		{"0c:42:a1:5e:7d:30", `^[0-9a-f][2367abef](:[0-9a-f]{2}){5}$`},
+		{"10.1.2.3", `^10\.\d+\.\d+\.\d+$`},
+		{"10.1.2.3/20", `^10\.\d+\.\d+\.\d+/20$`},
+		{"2001:db8::5/64", `^fd[0-9a-f]{2}:.*/64$`},
+		{"fe80::ec4:7aff:fe5e:7d30/64", `^fe80::.*/64$`},
+		{"127.0.0.1/8", `^127\.0\.0\.1/8$`},
+		{"4C4C4544-0047-3510-8052-B7C04F4E4D32", `^[0-9a-f]{8}(-[0-9a-f]{4}){3}-[0-9a-f]{12}$`},
+		{"7XJ2K52", `^redacted-[0-9a-f]{12}$`},
+		{"To Be Filled By O.E.M.", `^To Be Filled By O\.E\.M\.$`},
+		{"", `^$`},
+	} {
+		got := r.Value(tc.in)
+		if !regexp.MustCompile(tc.want).MatchString(got) {
+			t.Errorf("%q was redacted to %q, want it to match %s", tc.in, got, tc.want)
+		}
+		if tc.in != "" && !strings.HasPrefix(tc.in, "127.") && !strings.HasPrefix(tc.in, "To Be") && got == tc.in {
+			t.Errorf("%q was not redacted", tc.in)
+		}
+		if again := r.Value(tc.in); again != got {
+			t.Errorf("%q was redacted to %q, then to %q", tc.in, got, again)
+		}
+	}
+	if r.Value("0C-42-A1-5E-7D-30") != r.Value("0c:42:a1:5e:7d:30") {
+		t.Errorf("The same MAC address written differently has different pseudonyms")
+	}
+	if (&Redactor{Key: []byte("secret")}).Value("7XJ2K52") == r.Value("7XJ2K52") {
+		t.Errorf("The key does not change pseudonyms")
+	}
+	ib := "80:00:02:08:fe:80:00:00:00:00:00:00:00:02:c9:03:00:0f:b6:a1"
+	if hw, err := net.ParseMAC(r.Value(ib)); err != nil || len(hw) != 20 {
+		t.Errorf("InfiniBand address was redacted to %s", r.Value(ib))
+	}
+}
+
+func TestRedact(t *testing.T) {
+	r := &Redactor{}
+	doc := map[string]interface{}{
+		"Networking": map[string]interface{}{
+			"HardwareAddrs": map[string]interface{}{"0c:42:a1:5e:7d:30": "enx0c42a15e7d30"},
+			"Addrs":         map[string]interface{}{"10.1.2.3/20": "enx0c42a15e7d30"},
+			"Interfaces": []interface{}{
+				map[string]interface{}{
+					"Name":         "enx0c42a15e7d30",
+					"HardwareAddr": "0c:42:a1:5e:7d:30",
+					"Addrs":        []interface{}{"10.1.2.3/20"},
+					"MTU":          int64(1500),
+				},
+			},
+		},
+		"Storage": map[string]interface{}{
+			"Controllers": []interface{}{
+				map[string]interface{}{"serial": "0c:42:a1:5e:7d:30", "configuration": map[string]interface{}{"ip": "10.1.2.3"}},
+			},
+		},
+	}
+	tree, err := r.Redact(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, name := r.Value("0c:42:a1:5e:7d:30"), "enx"+strings.Replace(r.Value("0c:42:a1:5e:7d:30"), ":", "", -1)
+	addr, ip := r.Value("10.1.2.3/20"), r.Value("10.1.2.3")
+	for path, want := range map[string]interface{}{
+		"Networking.Interfaces.0.Name":           name,
+		"Networking.Interfaces.0.MTU":            int64(1500),
+		"Networking.Interfaces.0.Addrs.0":        addr,
+		"Storage.Controllers.0.serial":           mac,
+		"Storage.Controllers.0.configuration.ip": ip,
+	} {
+		if got := get(tree, path); got != want {
+			t.Errorf("%s is %v, want %v", path, got, want)
+		}
+	}
+	networking := tree.(map[string]interface{})["Networking"].(map[string]interface{})
+	if got := networking["HardwareAddrs"].(map[string]interface{})[mac]; got != name {
+		t.Errorf("HardwareAddrs[%s] is %v, want %s", mac, got, name)
+	}
+	if got := networking["Addrs"].(map[string]interface{})[addr]; got != name {
+		t.Errorf("Addrs[%s] is %v, want %s", addr, got, name)
+	}
+	if !strings.HasPrefix(addr, ip+"/") {
+		t.Errorf("Address %s and IP %s do not line up", addr, ip)
+	}
+}
+
+// get follows a dotted path of fields, or list indexes, from v.
+func get(v interface{}, path string) interface{} {
+	for _, part := range strings.Split(path, ".") {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			v = val[part]
+		case []interface{}:
+			if part != "0" || len(val) == 0 {
+				return nil
+			}
+			v = val[0]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// TestFixtures checks that none of the serial numbers, MAC addresses
+// and IP addresses gathered from each machine are left in its
+// redacted document.
+func TestFixtures(t *testing.T) {
+	secret := regexp.MustCompile(`"(?:Serial|SerialNumber|UUID|HardwareAddr)":"([^"]+)"|"(\d+\.\d+\.\d+\.\d+|[0-9a-f:]*:[0-9a-f:]+)(?:/\d+)?"`)
+	for _, m := range fixtures.Machines(t) {
+		inv, err := gohai.Gather(context.Background(), gohai.Options{Root: m.Root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := format.Tree(inv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before, _ := json.Marshal(doc)
+		tree, err := (&Redactor{}).Redact(inv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, _ := json.Marshal(tree)
+		for _, match := range secret.FindAllStringSubmatch(string(before), -1) {
+			value := match[1] + match[2]
+			if match[2] != "" {
+				if _, err := net.ParseMAC(value); err != nil && net.ParseIP(value) == nil {
+					continue
+				}
+			}
+			if unset[strings.ToLower(value)] || strings.HasPrefix(value, "127.") || value == "::1" {
+				continue
+			}
+			if strings.Contains(string(after), `"`+value) {
+				t.Errorf("%s: %s was not redacted", m.Name, value)
+			}
+		}
+	}
+}
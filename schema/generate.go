@@ -0,0 +1,223 @@
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// Draft is the JSON Schema draft generated schemas follow.
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+var (
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || (t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(iface))
+}
+
+// Generate returns the JSON Schema of the JSON form of values of type
+// t, in the current Version.  Named struct types are titled with
+// their Go type.
+func Generate(t reflect.Type) map[string]interface{} {
+	return generate(t, map[reflect.Type]bool{})
+}
+
+func nullable(s map[string]interface{}) map[string]interface{} {
+	if t, ok := s["type"].(string); ok {
+		s["type"] = []string{t, "null"}
+	}
+	return s
+}
+
+func generate(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	switch {
+	case implements(t, jsonMarshaler):
+		return marshaled(t)
+	case implements(t, textMarshaler):
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && !implements(t.Elem(), jsonMarshaler) && !implements(t.Elem(), textMarshaler) {
+			return map[string]interface{}{"type": []string{"string", "null"}, "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": generate(t.Elem(), seen)}
+	case reflect.Array:
+		return map[string]interface{}{
+			"type":     "array",
+			"items":    generate(t.Elem(), seen),
+			"minItems": t.Len(),
+			"maxItems": t.Len(),
+		}
+	case reflect.Map:
+		return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": generate(t.Elem(), seen)}
+	case reflect.Ptr:
+		return nullable(generate(t.Elem(), seen))
+	case reflect.Struct:
+		if seen[t] {
+			// Recursive types are left open.
+			return map[string]interface{}{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		props := map[string]interface{}{}
+		fields(t, seen, props)
+		res := map[string]interface{}{"type": "object", "properties": props}
+		if t.Name() != "" {
+			res["title"] = path.Base(t.PkgPath()) + "." + t.Name()
+		}
+		return res
+	}
+	// Interfaces, and anything else, can hold anything.
+	return map[string]interface{}{}
+}
+
+// fields adds the properties for the fields of struct type t to props
+// the way encoding/json writes them.
+func fields(t reflect.Type, seen map[reflect.Type]bool, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !implements(ft, jsonMarshaler) && !implements(ft, textMarshaler) {
+				fields(ft, seen, props)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = generate(ft, seen)
+	}
+}
+
+// marshaled returns the schema of a type that writes its own JSON,
+// going by what its zero value looks like.
+func marshaled(t reflect.Type) map[string]interface{} {
+	v := reflect.New(t)
+	if t.Kind() == reflect.Map {
+		// A nil map would be written as null.
+		v.Elem().Set(reflect.MakeMap(t))
+	}
+	if !t.Implements(jsonMarshaler) {
+		v = v.Elem()
+	}
+	buf, err := json.Marshal(v.Interface())
+	var val interface{}
+	if err == nil {
+		err = json.Unmarshal(buf, &val)
+	}
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	switch val.(type) {
+	case map[string]interface{}:
+		return map[string]interface{}{"type": "object"}
+	case []interface{}:
+		return map[string]interface{}{"type": "array"}
+	case string:
+		return map[string]interface{}{"type": "string"}
+	case float64:
+		return map[string]interface{}{"type": "number"}
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	}
+	return map[string]interface{}{}
+}
+
+// Class returns the JSON Schema of a class with Go type t, in the
+// layout of version.
+func Class(class string, t reflect.Type, version int) (map[string]interface{}, error) {
+	if err := Check(version); err != nil {
+		return nil, err
+	}
+	res := Generate(t)
+	downgrade(class, res, version)
+	res["$schema"] = Draft
+	res["title"] = fmt.Sprintf("gohai %s, schema version %d", class, version)
+	return res, nil
+}
+
+// Document returns the JSON Schema of a whole document in the layout
+// of version.  classes has the Go type of each class, and problem the
+// Go type of what is reported in Errors and Warnings.
+func Document(classes map[string]reflect.Type, problem reflect.Type, version int) (map[string]interface{}, error) {
+	if err := Check(version); err != nil {
+		return nil, err
+	}
+	props := map[string]interface{}{}
+	for class, t := range classes {
+		props[class] = Generate(t)
+		downgrade(class, props[class].(map[string]interface{}), version)
+	}
+	problems := map[string]interface{}{"type": "array", "items": Generate(problem)}
+	props["Errors"], props["Warnings"] = problems, problems
+	if version > 1 {
+		props[VersionKey] = map[string]interface{}{"type": "integer", "const": version}
+	}
+	return map[string]interface{}{
+		"$schema":    Draft,
+		"title":      fmt.Sprintf("gohai inventory, schema version %d", version),
+		"type":       "object",
+		"properties": props,
+	}, nil
+}
+
+// downgrade changes the schema s of class, which is in the current
+// Version, to the layout of version.
+func downgrade(class string, s map[string]interface{}, version int) {
+	for i := len(Changes) - 1; i >= 0; i-- {
+		c := Changes[i]
+		p := splitPath(c.Object)
+		if c.Version <= version || p[0] != class {
+			continue
+		}
+		schemaObjects(s, p[1:], func(props map[string]interface{}) { rename(props, c.New, c.Old) })
+	}
+}
+
+// schemaObjects calls fn with the properties of every object at path
+// in the schema s.
+func schemaObjects(s map[string]interface{}, path []string, fn func(map[string]interface{})) {
+	if len(path) == 0 {
+		if props, ok := s["properties"].(map[string]interface{}); ok {
+			fn(props)
+		}
+		return
+	}
+	var next interface{}
+	if path[0] == "*" {
+		next = s["items"]
+	} else if props, ok := s["properties"].(map[string]interface{}); ok {
+		next = props[path[0]]
+	}
+	if sub, ok := next.(map[string]interface{}); ok {
+		schemaObjects(sub, path[1:], fn)
+	}
+}
@@ -0,0 +1,136 @@
+// Package schema versions the layout of the documents gohai writes,
+// converts documents between versions, and generates JSON Schemas for
+// them from the Go types they are written from.
+//
+// Within a schema version, the layout only ever grows: classes,
+// sections and fields can be added, but never removed, renamed or
+// given a different type.  Anything else needs a new version, and a
+// Rename in Changes that says how to get from one version to the
+// other, so that documents in the old layout can still be written for
+// consumers that need them.
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Version is the schema version of the documents gohai writes.
+const Version = 2
+
+// VersionKey is the top-level key documents hold their schema
+// version in.  Documents without one are version 1.
+const VersionKey = "SchemaVersion"
+
+// Rename is a field that was renamed in a schema version.
+type Rename struct {
+	// Version is the schema version the field was renamed in.
+	Version int
+	// Object is the path to the objects the field is in, with every
+	// item of an array written as [*].
+	Object string
+	// Old and New are the names of the field before and after.
+	Old, New string
+}
+
+// Changes lists every change in the layout, oldest first.
+var Changes = []Rename{
+	{Version: 2, Object: "System.Processors[*]", Old: "Sibligs", New: "Siblings"},
+}
+
+// DocumentVersion returns the schema version of doc.
+func DocumentVersion(doc map[string]interface{}) int {
+	switch v := doc[VersionKey].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 1
+}
+
+// Check returns an error if version is not one that documents can be
+// written in.
+func Check(version int) error {
+	if version < 1 || version > Version {
+		return fmt.Errorf("Unknown schema version %d, must be between 1 and %d", version, Version)
+	}
+	return nil
+}
+
+// Convert changes doc, in the JSON form of a document, to the layout
+// of version.
+func Convert(doc map[string]interface{}, version int) error {
+	if err := Check(version); err != nil {
+		return err
+	}
+	from := DocumentVersion(doc)
+	if from > Version {
+		return fmt.Errorf("Document has schema version %d, which is newer than %d", from, Version)
+	}
+	for _, c := range Changes {
+		if c.Version > from && c.Version <= version {
+			objects(doc, splitPath(c.Object), func(obj map[string]interface{}) { rename(obj, c.Old, c.New) })
+		}
+	}
+	for i := len(Changes) - 1; i >= 0; i-- {
+		c := Changes[i]
+		if c.Version <= from && c.Version > version {
+			objects(doc, splitPath(c.Object), func(obj map[string]interface{}) { rename(obj, c.New, c.Old) })
+		}
+	}
+	if version == 1 {
+		delete(doc, VersionKey)
+	} else {
+		doc[VersionKey] = int64(version)
+	}
+	return nil
+}
+
+// splitPath splits an Object path into fields, with "*" for every
+// item of an array.
+func splitPath(p string) []string {
+	res := []string{}
+	for _, part := range strings.Split(p, ".") {
+		items := 0
+		for strings.HasSuffix(part, "[*]") {
+			part = strings.TrimSuffix(part, "[*]")
+			items++
+		}
+		res = append(res, part)
+		for ; items > 0; items-- {
+			res = append(res, "*")
+		}
+	}
+	return res
+}
+
+// objects calls fn with every object at path under v.
+func objects(v interface{}, path []string, fn func(map[string]interface{})) {
+	if len(path) == 0 {
+		if obj, ok := v.(map[string]interface{}); ok {
+			fn(obj)
+		}
+		return
+	}
+	if path[0] == "*" {
+		if arr, ok := v.([]interface{}); ok {
+			for _, item := range arr {
+				objects(item, path[1:], fn)
+			}
+		}
+		return
+	}
+	if obj, ok := v.(map[string]interface{}); ok {
+		objects(obj[path[0]], path[1:], fn)
+	}
+}
+
+func rename(obj map[string]interface{}, from, to string) {
+	if v, ok := obj[from]; ok {
+		delete(obj, from)
+		obj[to] = v
+	}
+}
@@ -0,0 +1,117 @@
+package schema
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func doc(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	res := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestConvert(t *testing.T) {
+	v1 := `{"System": {"Processors": [{"ID": 0, "Sibligs": 2}, {"ID": 1, "Sibligs": 2}]}}`
+	v2 := `{"SchemaVersion": 2, "System": {"Processors": [{"ID": 0, "Siblings": 2}, {"ID": 1, "Siblings": 2}]}}`
+	for _, tc := range []struct {
+		from    string
+		version int
+		want    string
+	}{
+		{v1, 2, v2},
+		{v2, 1, v1},
+		{v1, 1, v1},
+		{v2, 2, v2},
+		{`{"DMI": {}}`, 2, `{"DMI": {}, "SchemaVersion": 2}`},
+	} {
+		got := doc(t, tc.from)
+		if err := Convert(got, tc.version); err != nil {
+			t.Fatal(err)
+		}
+		want := doc(t, tc.want)
+		gotBuf, _ := json.Marshal(got)
+		wantBuf, _ := json.Marshal(want)
+		if string(gotBuf) != string(wantBuf) {
+			t.Errorf("Converting %s to %d got %s, want %s", tc.from, tc.version, gotBuf, wantBuf)
+		}
+	}
+	for _, version := range []int{0, Version + 1} {
+		if err := Convert(doc(t, v2), version); err == nil {
+			t.Errorf("Expected converting to version %d to fail", version)
+		}
+	}
+	if err := Convert(doc(t, `{"SchemaVersion": 99}`), Version); err == nil {
+		t.Errorf("Expected converting from a newer version to fail")
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	for p, want := range map[string][]string{
+		"System.Processors[*]":   {"System", "Processors", "*"},
+		"DMI.Memory.Devices":     {"DMI", "Memory", "Devices"},
+		"Storage.Grid[*][*].Col": {"Storage", "Grid", "*", "*", "Col"},
+	} {
+		if got := splitPath(p); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitPath(%s) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+type addr struct{ net.IP }
+
+func (a addr) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+type counts map[string]int
+
+func (c counts) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]int(c))
+}
+
+type embedded struct {
+	Shared string
+	hidden int
+}
+
+type sample struct {
+	embedded
+	Name     string
+	Renamed  int  `json:"renamed,omitempty"`
+	Skipped  bool `json:"-"`
+	Ratio    float64
+	Tags     []string
+	Raw      []byte
+	Pair     [2]uint8
+	Addr     addr
+	Counts   counts
+	Parent   *sample
+	Any      interface{}
+	internal string
+}
+
+func TestGenerate(t *testing.T) {
+	got, _ := json.Marshal(Generate(reflect.TypeOf(sample{})))
+	want := `{"properties":{` +
+		`"Addr":{"type":"string"},` +
+		`"Any":{},` +
+		`"Counts":{"type":"object"},` +
+		`"Name":{"type":"string"},` +
+		`"Pair":{"items":{"type":"integer"},"maxItems":2,"minItems":2,"type":"array"},` +
+		`"Parent":{"type":["object","null"]},` +
+		`"Ratio":{"type":"number"},` +
+		`"Raw":{"contentEncoding":"base64","type":["string","null"]},` +
+		`"Shared":{"type":"string"},` +
+		`"Tags":{"items":{"type":"string"},"type":["array","null"]},` +
+		`"renamed":{"type":"integer"}},` +
+		`"title":"schema.sample","type":"object"}`
+	if string(got) != want {
+		t.Errorf("Got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,222 @@
+// Package server serves gohai inventories over HTTP, so that running
+// systems can be polled for what they have without logging in to them.
+//
+// It answers:
+//
+//	/inventory          the whole document, as the gohai command writes it
+//	/inventory/{class}  one class in the document, like /inventory/Storage
+//	/metrics            the numbers in the document, as Prometheus metrics
+//	/healthz            "ok", as long as the server is up
+//
+// The inventory endpoints take a format parameter with any of the
+// output formats in the format package, like /inventory?format=yaml.
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rackn/gohai"
+	"github.com/rackn/gohai/format"
+	"github.com/rackn/gohai/metrics"
+	"github.com/rackn/gohai/redact"
+	"github.com/rackn/gohai/schema"
+)
+
+// Server is an http.Handler that serves inventories.
+type Server struct {
+	// Options is what each inventory is gathered with.
+	Options gohai.Options
+	// SchemaVersion is the layout documents are written in.  It
+	// defaults to the current schema.Version.
+	SchemaVersion int
+	// Interval, if not 0, is how long an inventory is served for
+	// before it is gathered again.  Otherwise every request gathers a
+	// new one.
+	Interval time.Duration
+	// Redactor, if set, redacts the documents that are served.
+	Redactor *redact.Redactor
+
+	// mu keeps more than one gather from running at a time, and
+	// guards what the last one gathered.
+	mu       sync.Mutex
+	inv      *gohai.Inventory
+	err      error
+	gathered time.Time
+}
+
+// Refresh gathers a new inventory and serves it from now on.
+func (s *Server) Refresh(ctx context.Context) (*gohai.Inventory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refresh(ctx)
+}
+
+func (s *Server) refresh(ctx context.Context) (*gohai.Inventory, error) {
+	inv, err := gohai.Gather(ctx, s.Options)
+	if ctx.Err() != nil {
+		// A request that went away says nothing about the system.
+		return inv, err
+	}
+	s.inv, s.err, s.gathered = inv, err, time.Now()
+	return inv, err
+}
+
+// Inventory returns the inventory to serve for a request that arrived
+// at since.  A gather that finished after since is as good as a new
+// one, so requests that arrive while one is running share it.
+func (s *Server) Inventory(ctx context.Context, since time.Time) (*gohai.Inventory, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fresh := s.gathered.After(since)
+	if s.Interval > 0 {
+		fresh = !s.gathered.IsZero() && time.Since(s.gathered) < s.Interval
+	}
+	if !fresh {
+		if s.refresh(ctx); ctx.Err() != nil {
+			return nil, time.Time{}, ctx.Err()
+		}
+	}
+	return s.inv, s.gathered, s.err
+}
+
+// Run gathers a new inventory every Interval until ctx is done, so
+// that requests do not have to wait for one once the first has been
+// gathered.
+func (s *Server) Run(ctx context.Context) {
+	if s.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Refresh(ctx)
+		}
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, fmt.Sprintf("Method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	switch p := strings.TrimSuffix(r.URL.Path, "/"); {
+	case p == "/healthz":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	case p == "/inventory":
+		s.serveInventory(w, r, "")
+	case p == "/metrics":
+		s.serveMetrics(w, r)
+	case strings.HasPrefix(p, "/inventory/") && !strings.Contains(p[len("/inventory/"):], "/"):
+		s.serveInventory(w, r, p[len("/inventory/"):])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveInventory(w http.ResponseWriter, r *http.Request, class string) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = "json"
+	}
+	formatter, err := format.Lookup(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	version := s.SchemaVersion
+	if version == 0 {
+		version = schema.Version
+	}
+	inv, gathered, err := s.Inventory(r.Context(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	doc, err := s.document(inv, version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var out interface{} = doc
+	if class != "" {
+		if out = lookup(doc, class); out == nil {
+			http.Error(w, fmt.Sprintf("No class %s in the inventory", class), http.StatusNotFound)
+			return
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := formatter(buf, out); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to write %s output: %v", name, err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType(name))
+	w.Header().Set("Last-Modified", gathered.UTC().Format(http.TimeFormat))
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+}
+
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	inv, gathered, err := s.Inventory(r.Context(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The metrics always go by the current layout.
+	doc, err := s.document(inv, schema.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf := &bytes.Buffer{}
+	if err := metrics.Write(buf, doc); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to write metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(buf, "# HELP gohai_gathered_timestamp_seconds When the inventory was gathered.\n")
+	fmt.Fprintf(buf, "# TYPE gohai_gathered_timestamp_seconds gauge\n")
+	fmt.Fprintf(buf, "gohai_gathered_timestamp_seconds %d\n", gathered.Unix())
+	w.Header().Set("Content-Type", format.ContentType("prometheus"))
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+}
+
+// document returns the document to serve for inv, in the layout of
+// version.
+func (s *Server) document(inv *gohai.Inventory, version int) (map[string]interface{}, error) {
+	doc, err := inv.Document(version)
+	if err != nil || s.Redactor == nil {
+		return doc, err
+	}
+	tree, err := s.Redactor.Redact(doc)
+	if err != nil {
+		return nil, err
+	}
+	return tree.(map[string]interface{}), nil
+}
+
+// lookup finds class in doc, ignoring case if there is no exact match.
+func lookup(doc map[string]interface{}, class string) interface{} {
+	if v, ok := doc[class]; ok {
+		return v
+	}
+	for k, v := range doc {
+		if strings.EqualFold(k, class) {
+			return v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rackn/gohai"
+	"github.com/rackn/gohai/internal/fixtures"
+	"github.com/rackn/gohai/redact"
+)
+
+func get(t *testing.T, ts *httptest.Server, method, path string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestServer(t *testing.T) {
+	m := fixtures.Lookup(t, "supermicro-epyc-7232p")
+	srv := &Server{Options: gohai.Options{Root: m.Root}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		contentType  string
+		body         string
+	}{
+		{"GET", "/healthz", 200, "text/plain; charset=utf-8", "ok\n"},
+		{"GET", "/inventory", 200, "application/json; charset=utf-8", `"SchemaVersion": 2`},
+		{"GET", "/inventory/", 200, "application/json; charset=utf-8", `"Storage": {`},
+		{"GET", "/inventory/Storage", 200, "application/json; charset=utf-8", `"Serial": "ZC1234AB"`},
+		{"GET", "/inventory/storage", 200, "application/json; charset=utf-8", `"Serial": "ZC1234AB"`},
+		{"GET", "/inventory/System?format=yaml", 200, "application/yaml; charset=utf-8", "Arch: amd64"},
+		{"GET", "/inventory/System?format=flat", 200, "text/plain; charset=utf-8", "Arch=amd64"},
+		{"GET", "/metrics", 200, "text/plain; version=0.0.4; charset=utf-8",
+			`gohai_storage_disk_size_bytes{disk="/dev/sda",serial="ZC1234AB"} 4000787030016`},
+		{"GET", "/metrics", 200, "", "\ngohai_gathered_timestamp_seconds "},
+		{"HEAD", "/inventory", 200, "application/json; charset=utf-8", ""},
+		{"GET", "/inventory/Nope", 404, "", "No class Nope in the inventory"},
+		{"GET", "/inventory/Storage/Disks", 404, "", "not found"},
+		{"GET", "/inventory?format=nope", 400, "", "nope"},
+		{"GET", "/", 404, "", "not found"},
+		{"POST", "/inventory", 405, "", "Method POST is not allowed"},
+	} {
+		resp, body := get(t, ts, tc.method, tc.path)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: status %d, want %d: %s", tc.method, tc.path, resp.StatusCode, tc.status, body)
+			continue
+		}
+		if ct := resp.Header.Get("Content-Type"); tc.contentType != "" && ct != tc.contentType {
+			t.Errorf("%s %s: content type %s, want %s", tc.method, tc.path, ct, tc.contentType)
+		}
+		if !strings.Contains(body, tc.body) || (tc.method == "HEAD" && body != "") {
+			t.Errorf("%s %s: body does not have %s", tc.method, tc.path, tc.body)
+		}
+	}
+	_, body := get(t, ts, "GET", "/inventory/DMI")
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc["Memory"]; !ok {
+		t.Errorf("DMI is %v", doc)
+	}
+	srv.Redactor = &redact.Redactor{}
+	for _, path := range []string{"/inventory/Storage", "/metrics"} {
+		if _, body := get(t, ts, "GET", path); strings.Contains(body, "ZC1234AB") ||
+			!strings.Contains(body, srv.Redactor.Value("ZC1234AB")) {
+			t.Errorf("%s was not redacted", path)
+		}
+	}
+}
+
+func TestServerInventory(t *testing.T) {
+	m := fixtures.Lookup(t, "qemu-kvm-guest")
+	ctx := context.Background()
+	srv := &Server{Options: gohai.Options{Root: m.Root, Only: []string{"System"}}}
+	_, first, err := srv.Inventory(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A request that arrived before the last gather finished shares it.
+	if _, at, _ := srv.Inventory(ctx, first.Add(-time.Second)); !at.Equal(first) {
+		t.Errorf("Gathered again for a request that arrived during a gather")
+	}
+	if _, at, _ := srv.Inventory(ctx, time.Now()); !at.After(first) {
+		t.Errorf("Did not gather again for a new request")
+	}
+	srv.Interval = time.Hour
+	_, cached, _ := srv.Inventory(ctx, time.Now())
+	if _, at, _ := srv.Inventory(ctx, time.Now()); !at.Equal(cached) {
+		t.Errorf("Gathered again within the refresh interval")
+	}
+	if _, err := srv.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, at, _ := srv.Inventory(ctx, time.Now()); !at.After(cached) {
+		t.Errorf("Refresh did not gather again")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	srv = &Server{Options: srv.Options}
+	if inv, _, err := srv.Inventory(cancelled, time.Now()); err == nil || inv != nil {
+		t.Errorf("Expected a cancelled request to fail")
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	srv := &Server{Options: gohai.Options{Only: []string{"Nope"}}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	if resp, body := get(t, ts, "GET", "/inventory"); resp.StatusCode != 500 || !strings.Contains(body, "Invalid selection") {
+		t.Errorf("Got %d: %s", resp.StatusCode, body)
+	}
+	if resp, _ := get(t, ts, "GET", "/healthz"); resp.StatusCode != 200 {
+		t.Errorf("Health check failed with %d", resp.StatusCode)
+	}
+}